@@ -0,0 +1,36 @@
+import { finalizeEvent, type EventTemplate, type VerifiedEvent } from "nostr-tools"
+import { useStore } from "./store"
+
+// The relay only accepts events carrying an id, pubkey and signature, so
+// everything we send is signed with the user's key.
+export function signEvent(template: EventTemplate): VerifiedEvent {
+  const { userSecret } = useStore.getState();
+  if (!userSecret) {
+    throw new Error("No Nostr key to sign the event with");
+  }
+  return finalizeEvent(template, hexToBytes(userSecret));
+}
+
+// Events sent for a subscription arrive as ["EVENT", <subscription id>, event],
+// while those the relay writes straight back to us are ["EVENT", event]; in
+// both the event comes last.
+export function eventFromMessage(data: unknown): any | null {
+  if (!Array.isArray(data) || data[0] !== "EVENT" || data.length < 2) {
+    return null;
+  }
+  return data[data.length - 1];
+}
+
+// referencesEvent reports whether a job result or feedback event answers the
+// request with the given id.
+export function referencesEvent(event: any, id: string): boolean {
+  return Array.isArray(event?.tags) && event.tags.some((tag: string[]) => tag[0] === "e" && tag[1] === id);
+}
+
+function hexToBytes(hex: string): Uint8Array {
+  const bytes = new Uint8Array(hex.length / 2);
+  for (let i = 0; i < bytes.length; i++) {
+    bytes[i] = parseInt(hex.substr(i * 2, 2), 16);
+  }
+  return bytes;
+}
@@ -1,5 +1,6 @@
 import { Audio } from "expo-av"
 import * as FileSystem from "expo-file-system"
+import { eventFromMessage, referencesEvent, signEvent } from "./nostrEvent"
 import { useStore } from "./store"
 
 export async function sendAudioToRelay(audioUri: string, socket: WebSocket, onTranscriptionReceived: (transcription: string) => void): Promise<void> {
@@ -11,7 +12,7 @@ export async function sendAudioToRelay(audioUri: string, socket: WebSocket, onTr
 
       const { activeRepoUrl } = useStore.getState();
 
-      const event = {
+      const event = signEvent({
         kind: 5252, // NIP-90 range for audio events; we'll use 5252 for speech-to-text
         content: "",
         created_at: Math.floor(Date.now() / 1000),
@@ -21,24 +22,24 @@ export async function sendAudioToRelay(audioUri: string, socket: WebSocket, onTr
           ["output", "text/plain"],
           ["bid", "0"]
         ],
-      };
+      });
 
       const message = JSON.stringify(["EVENT", event]);
 
       socket.send(message);
 
       // Set up a listener for the 6252 event (speech-to-text response)
-      const listener = (event: MessageEvent) => {
-        const data = JSON.parse(event.data);
+      const listener = (msg: MessageEvent) => {
+        const data = JSON.parse(msg.data);
         console.log("Received data:", data);
-        if (Array.isArray(data) && data[0] === "EVENT") {
-          const eventData = data[1];
-          if (eventData.kind === 6252) {
+        const eventData = eventFromMessage(data);
+        if (eventData) {
+          if (eventData.kind === 6252 && referencesEvent(eventData, event.id)) {
             const transcription = eventData.content;
             onTranscriptionReceived(transcription);
 
             // Send the 5838 event (agent command request)
-            const agentCommandEvent = {
+            const agentCommandEvent = signEvent({
               kind: 5838, // NIP-90 kind for agent command request
               content: "",
               created_at: Math.floor(Date.now() / 1000),
@@ -49,7 +50,7 @@ export async function sendAudioToRelay(audioUri: string, socket: WebSocket, onTr
                 ["t", "agent_command"],
                 ["param", "repo", activeRepoUrl]
               ],
-            };
+            });
 
             const agentCommandMessage = JSON.stringify(["EVENT", agentCommandEvent]);
 
@@ -1,4 +1,5 @@
 import { useEffect } from 'react';
+import { eventFromMessage } from './nostrEvent';
 
 interface MessageHandlerProps {
   socket: WebSocket | null;
@@ -16,8 +17,8 @@ export const useMessageHandler = ({
       const messageHandler = (event: MessageEvent) => {
         const data = JSON.parse(event.data);
         console.log("Received data:", data);
-        if (Array.isArray(data) && data[0] === "EVENT") {
-          const eventData = data[1];
+        const eventData = eventFromMessage(data);
+        if (eventData) {
           console.log("Event data:", eventData);
           if (eventData.kind === 6838) {
             setAgentResponse(eventData.content);
@@ -0,0 +1,425 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// ErrDisconnected is returned for requests that were in flight, or made,
+// while the connection to the relay was down.
+var ErrDisconnected = errors.New("not connected to relay")
+
+// ErrClosed is returned once Close has been called.
+var ErrClosed = errors.New("client is closed")
+
+type Options struct {
+	// SecretKey signs published events that are not already signed. Without
+	// one, unsigned events are sent with only their ID computed, which
+	// relays that verify signatures reject.
+	SecretKey string
+	// ReconnectDelay is the first wait before reconnecting; it doubles on
+	// every failed attempt up to MaxReconnectDelay.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// DisableReconnect leaves the client disconnected when the connection
+	// drops; requests then fail with ErrDisconnected.
+	DisableReconnect bool
+	// Logger receives connection problems and relay notices. It defaults
+	// to the relay's logger.
+	Logger Logger
+	// NetDialContext, if set, opens the TCP connections to the relay, and
+	// proxy settings from the environment are ignored.
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// Logger is the subset of a structured logger the client needs. keyvals
+// are alternating field names and values.
+type Logger interface {
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+}
+
+// Client is a connection to a single relay. It reconnects when the
+// connection drops and reopens its subscriptions.
+type Client struct {
+	url    string
+	opts   Options
+	log    Logger
+	dialer *websocket.Dialer
+
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+
+	subs    map[string]*Subscription
+	pending map[string]chan okResult
+	// direct receives EVENT messages without a subscription ID, which is how
+	// the relay delivers job results to the connection that submitted them.
+	direct map[int]func(*nostr.Event)
+	nextID int
+	closed bool
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+type okResult struct {
+	accepted bool
+	message  string
+}
+
+// RejectedError is returned by Publish when the relay answers OK false.
+type RejectedError struct {
+	EventID string
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("relay rejected event %s: %s", e.EventID, e.Message)
+}
+
+// Dial connects to the relay at url. A failed connection's error wraps the
+// one returned by Options.NetDialContext.
+func Dial(ctx context.Context, url string, opts Options) (*Client, error) {
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = time.Second
+	}
+	if opts.MaxReconnectDelay < opts.ReconnectDelay {
+		opts.MaxReconnectDelay = 30 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Default().With("relay", url)
+	}
+
+	c := &Client{
+		url:     url,
+		opts:    opts,
+		log:     opts.Logger,
+		dialer:  websocket.DefaultDialer,
+		subs:    make(map[string]*Subscription),
+		pending: make(map[string]chan okResult),
+		direct:  make(map[int]func(*nostr.Event)),
+		done:    make(chan struct{}),
+	}
+	if opts.NetDialContext != nil {
+		c.dialer = &websocket.Dialer{
+			NetDialContext:   opts.NetDialContext,
+			HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		}
+	}
+	ws, _, err := c.dialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	c.ws = ws
+	go c.readLoop(ws)
+	return c, nil
+}
+
+// Close closes the connection and every subscription.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	ws := c.ws
+	c.ws = nil
+	subs := make([]*Subscription, 0, len(c.subs))
+	for id, sub := range c.subs {
+		delete(c.subs, id)
+		subs = append(subs, sub)
+	}
+	c.failPending()
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close("client closed")
+	}
+
+	if ws == nil {
+		return nil
+	}
+	c.writeMu.Lock()
+	_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	c.writeMu.Unlock()
+	return ws.Close()
+}
+
+// Publish sends the event and waits for the relay's OK. Unsigned events are
+// signed with Options.SecretKey when one is set.
+func (c *Client) Publish(ctx context.Context, event *nostr.Event) error {
+	if event.Sig == "" {
+		if c.opts.SecretKey != "" {
+			err := event.Sign(c.opts.SecretKey)
+			if err != nil {
+				return err
+			}
+		} else {
+			event.ID = event.ComputeID()
+		}
+	}
+
+	result := make(chan okResult, 1)
+	c.mu.Lock()
+	c.pending[event.ID] = result
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, event.ID)
+		c.mu.Unlock()
+	}()
+
+	err := c.write([]interface{}{"EVENT", event})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case ok, open := <-result:
+		if !open {
+			return ErrDisconnected
+		}
+		if !ok.accepted {
+			return &RejectedError{EventID: event.ID, Message: ok.message}
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// onDirect registers fn to receive events the relay sends without a
+// subscription ID. The returned function unregisters it.
+func (c *Client) onDirect(fn func(*nostr.Event)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	c.direct[id] = fn
+	return func() {
+		c.mu.Lock()
+		delete(c.direct, id)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) write(v interface{}) error {
+	c.mu.Lock()
+	ws, closed := c.ws, c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if ws == nil {
+		return ErrDisconnected
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	err := ws.WriteJSON(v)
+	if err != nil {
+		return fmt.Errorf("failed to write to relay: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) readLoop(ws *websocket.Conn) {
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+			if !closed {
+				c.log.Warn("Connection to relay lost", "error", err)
+				c.reconnect(ws)
+			}
+			return
+		}
+		c.handleMessage(message)
+	}
+}
+
+func (c *Client) handleMessage(message []byte) {
+	var raw []json.RawMessage
+	err := json.Unmarshal(message, &raw)
+	if err != nil || len(raw) < 2 {
+		c.log.Warn("Ignoring malformed relay message", "error", err)
+		return
+	}
+	var label string
+	_ = json.Unmarshal(raw[0], &label)
+
+	switch label {
+	case "EVENT":
+		c.handleEvent(raw[1:])
+	case "OK":
+		var eventID, text string
+		var accepted bool
+		if len(raw) < 4 || json.Unmarshal(raw[1], &eventID) != nil || json.Unmarshal(raw[2], &accepted) != nil {
+			c.log.Warn("Ignoring malformed OK")
+			return
+		}
+		_ = json.Unmarshal(raw[3], &text)
+		c.mu.Lock()
+		if result, ok := c.pending[eventID]; ok {
+			select {
+			case result <- okResult{accepted: accepted, message: text}:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	case "EOSE":
+		if sub := c.subscription(raw[1]); sub != nil {
+			sub.eose()
+		}
+	case "CLOSED":
+		var reason string
+		if len(raw) > 2 {
+			_ = json.Unmarshal(raw[2], &reason)
+		}
+		sub := c.subscription(raw[1])
+		if sub == nil {
+			break
+		}
+		// "error:" is the relay's own trouble, such as shutting down, so the
+		// subscription is kept and reopened after reconnecting
+		if strings.HasPrefix(reason, "error:") {
+			c.log.Info("Subscription interrupted", "sub_id", sub.ID, "reason", reason)
+			break
+		}
+		c.mu.Lock()
+		delete(c.subs, sub.ID)
+		c.mu.Unlock()
+		sub.close(reason)
+	case "NOTICE":
+		var notice string
+		_ = json.Unmarshal(raw[1], &notice)
+		c.log.Info("Relay notice", "message", notice)
+	}
+}
+
+func (c *Client) handleEvent(args []json.RawMessage) {
+	var event nostr.Event
+	if len(args) == 1 {
+		if json.Unmarshal(args[0], &event) != nil {
+			c.log.Warn("Ignoring malformed event")
+			return
+		}
+		c.mu.Lock()
+		handlers := make([]func(*nostr.Event), 0, len(c.direct))
+		for _, fn := range c.direct {
+			handlers = append(handlers, fn)
+		}
+		c.mu.Unlock()
+		for _, fn := range handlers {
+			fn(&event)
+		}
+		return
+	}
+
+	if json.Unmarshal(args[1], &event) != nil {
+		c.log.Warn("Ignoring malformed event")
+		return
+	}
+	if sub := c.subscription(args[0]); sub != nil {
+		sub.event(&event)
+	}
+}
+
+func (c *Client) subscription(rawID json.RawMessage) *Subscription {
+	var id string
+	if json.Unmarshal(rawID, &id) != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subs[id]
+}
+
+// reconnect redials with exponential backoff until it succeeds or the
+// client is closed, then reopens every subscription.
+func (c *Client) reconnect(old *websocket.Conn) {
+	old.Close()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.ws = nil
+	c.failPending()
+	c.mu.Unlock()
+	if c.opts.DisableReconnect {
+		return
+	}
+
+	delay := c.opts.ReconnectDelay
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+
+		ws, _, err := c.dialer.Dial(c.url, nil)
+		if err != nil {
+			c.log.Warn("Reconnect failed", "error", err, "retry_in", delay)
+			delay *= 2
+			if delay > c.opts.MaxReconnectDelay {
+				delay = c.opts.MaxReconnectDelay
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			ws.Close()
+			return
+		}
+		c.ws = ws
+		subs := make([]*Subscription, 0, len(c.subs))
+		for _, sub := range c.subs {
+			subs = append(subs, sub)
+		}
+		c.mu.Unlock()
+
+		c.log.Info("Reconnected to relay", "subscriptions", len(subs))
+		go c.readLoop(ws)
+		for _, sub := range subs {
+			err = c.write(sub.request())
+			if err != nil {
+				c.log.Warn("Error reopening subscription", "sub_id", sub.ID, "error", err)
+			}
+		}
+		return
+	}
+}
+
+// failPending wakes every Publish waiting for an OK. Callers hold c.mu.
+func (c *Client) failPending() {
+	for id, result := range c.pending {
+		close(result)
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) newSubscriptionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return "sub" + strconv.Itoa(c.nextID)
+}
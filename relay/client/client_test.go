@@ -0,0 +1,329 @@
+package client_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/client"
+	"github.com/openagentsinc/v3/relay/internal/config"
+	"github.com/openagentsinc/v3/relay/internal/nip01"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// testServer serves handler and keeps hold of every upgraded connection so
+// tests can drop them to force the client to reconnect.
+type testServer struct {
+	*httptest.Server
+	conns []net.Conn
+	mu    sync.Mutex
+}
+
+func newTestServer(t *testing.T, handler http.Handler) *testServer {
+	t.Helper()
+	s := &testServer{Server: httptest.NewUnstartedServer(handler)}
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateHijacked {
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) url() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// dropConnections closes every websocket connection from the server side.
+func (s *testServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// newTestRelay serves a relay with fake model backends.
+func newTestRelay(t *testing.T) *testServer {
+	t.Helper()
+	secretKey := newKey(t)
+	cfg := config.Default()
+	cfg.Relay.DataDir = t.TempDir()
+	cfg.Provider.SecretKey = secretKey
+	cfg.Services = map[int]config.ServiceConfig{
+		5252: {Backend: config.BackendFake},
+		5838: {Backend: config.BackendFake},
+	}
+
+	relay := nip01.NewRelay(cfg)
+	server := newTestServer(t, http.HandlerFunc(relay.HandleWebSocket))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = relay.Shutdown(ctx)
+	})
+	return server
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func dial(t *testing.T, url string, opts client.Options) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, url, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func note(content string, tags ...[]string) *nostr.Event {
+	if tags == nil {
+		tags = [][]string{}
+	}
+	return &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Tags: tags, Content: content}
+}
+
+func TestPublish(t *testing.T) {
+	server := newTestRelay(t)
+	c := dial(t, server.url(), client.Options{SecretKey: newKey(t)})
+	ctx := testContext(t)
+
+	event := note("hello")
+	err := c.Publish(ctx, event)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if !event.CheckSignature() {
+		t.Error("published event was not signed")
+	}
+
+	expired := note("stale", []string{"expiration", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)})
+	err = c.Publish(ctx, expired)
+	var rejected *client.RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected a RejectedError, got %v", err)
+	}
+	if rejected.EventID != expired.ID || rejected.Message != "invalid: event has expired" {
+		t.Errorf("unexpected rejection %+v", rejected)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	server := newTestRelay(t)
+	key := newKey(t)
+	c := dial(t, server.url(), client.Options{SecretKey: key})
+	ctx := testContext(t)
+
+	stored := note("stored")
+	if err := c.Publish(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *nostr.Event, 10)
+	eose := make(chan struct{})
+	pubKey, _ := nostr.GetPublicKey(key)
+	_, err := c.Subscribe(ctx, []*nostr.Filter{{Kinds: []int{1}, Authors: []string{pubKey}}}, client.Callbacks{
+		OnEvent: func(event *nostr.Event) { events <- event },
+		OnEOSE:  func() { close(eose) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := receive(t, events); got.ID != stored.ID {
+		t.Errorf("got stored event %s, want %s", got.ID, stored.ID)
+	}
+	select {
+	case <-eose:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no EOSE")
+	}
+
+	live := note("live")
+	if err := c.Publish(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, events); got.ID != live.ID {
+		t.Errorf("got live event %s, want %s", got.ID, live.ID)
+	}
+}
+
+func TestReconnectReopensSubscriptions(t *testing.T) {
+	server := newTestRelay(t)
+	key := newKey(t)
+	c := dial(t, server.url(), client.Options{SecretKey: key, ReconnectDelay: 10 * time.Millisecond})
+	ctx := testContext(t)
+
+	events := make(chan *nostr.Event, 10)
+	eose := make(chan struct{}, 2)
+	_, err := c.Subscribe(ctx, []*nostr.Filter{{Kinds: []int{1}}}, client.Callbacks{
+		OnEvent: func(event *nostr.Event) { events <- event },
+		OnEOSE:  func() { eose <- struct{}{} },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-eose:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no EOSE")
+	}
+
+	server.dropConnections()
+
+	// Publishing on a fresh connection shows the REQ was reopened: the
+	// event arrives either from stored events or as a live broadcast
+	other := dial(t, server.url(), client.Options{SecretKey: key})
+	event := note("after reconnect")
+	if err := other.Publish(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, events); got.ID != event.ID {
+		t.Errorf("got %s, want %s", got.ID, event.ID)
+	}
+
+	// And the reconnected client can publish again
+	err = retry(ctx, func() error { return c.Publish(ctx, note("from the client")) })
+	if err != nil {
+		t.Errorf("publish after reconnect: %v", err)
+	}
+	if len(eose) != 0 {
+		t.Error("OnEOSE called again after reconnecting")
+	}
+}
+
+// retry calls fn until it stops failing with ErrDisconnected.
+func retry(ctx context.Context, fn func() error) error {
+	for {
+		err := fn()
+		if err != client.ErrDisconnected {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func receive(t *testing.T, events <-chan *nostr.Event) *nostr.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestSubmitJob(t *testing.T) {
+	server := newTestRelay(t)
+	c := dial(t, server.url(), client.Options{SecretKey: newKey(t)})
+
+	audio := base64.StdEncoding.EncodeToString([]byte("audio"))
+	response, err := c.SubmitJob(testContext(t), client.JobRequest{
+		Kind:   5252,
+		Inputs: []client.JobInput{{Data: audio}},
+		Params: map[string]string{"format": "mp3"},
+	})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if response.Result == nil || response.Result.Kind != 6252 {
+		t.Fatalf("unexpected result %+v", response.Result)
+	}
+}
+
+// TestSubmitJobErrorFeedback runs against a scripted relay, since the
+// relay's own services report failures in their results.
+func TestSubmitJobErrorFeedback(t *testing.T) {
+	providerKey := newKey(t)
+	upgrader := websocket.Upgrader{}
+	server := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			var msg []json.RawMessage
+			if ws.ReadJSON(&msg) != nil {
+				return
+			}
+			var label string
+			_ = json.Unmarshal(msg[0], &label)
+			if label != "EVENT" {
+				continue
+			}
+			var request nostr.Event
+			_ = json.Unmarshal(msg[1], &request)
+			_ = ws.WriteJSON([]interface{}{"OK", request.ID, true, ""})
+
+			for _, status := range []string{"processing", "error"} {
+				feedback := &nostr.Event{
+					Kind:      client.KindJobFeedback,
+					CreatedAt: nostr.Now(),
+					Tags:      [][]string{{"status", status, "backend " + status}, {"e", request.ID}},
+				}
+				_ = feedback.Sign(providerKey)
+				_ = ws.WriteJSON([]interface{}{"EVENT", feedback})
+			}
+		}
+	}))
+	c := dial(t, server.url(), client.Options{SecretKey: newKey(t)})
+
+	var statuses []string
+	response, err := c.SubmitJob(testContext(t), client.JobRequest{
+		Kind:   5252,
+		Inputs: []client.JobInput{{Data: "audio"}},
+		OnFeedback: func(event *nostr.Event) {
+			statuses = append(statuses, event.Tags[0][1])
+		},
+	})
+	var jobErr *client.JobError
+	if !errors.As(err, &jobErr) {
+		t.Fatalf("expected a JobError, got %v", err)
+	}
+	if err.Error() != "job failed: backend error" {
+		t.Errorf("unexpected error %q", err)
+	}
+	if len(response.Feedback) != 2 || strings.Join(statuses, ",") != "processing,error" {
+		t.Errorf("unexpected feedback %v", statuses)
+	}
+	if response.Result != nil {
+		t.Errorf("unexpected result %+v", response.Result)
+	}
+}
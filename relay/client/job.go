@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// KindJobFeedback is the NIP-90 job feedback kind.
+const KindJobFeedback = 7000
+
+// JobRequest describes a NIP-90 job. The result kind is Kind + 1000.
+type JobRequest struct {
+	Kind   int
+	Inputs []JobInput
+	Params map[string]string
+	// Output is the requested output MIME type, such as "text/plain".
+	Output string
+	// Tags are appended after the generated ones.
+	Tags    [][]string
+	Content string
+	// OnFeedback, if set, is called for each feedback event as it arrives.
+	OnFeedback func(*nostr.Event)
+}
+
+// JobInput is an "i" tag: the data and its type (text, url, event or job).
+type JobInput struct {
+	Data string
+	Type string
+}
+
+// JobResponse is everything the service sent back for a job.
+type JobResponse struct {
+	Request  *nostr.Event
+	Feedback []*nostr.Event
+	Result   *nostr.Event
+}
+
+// JobError is returned when the service reports the job failed.
+type JobError struct {
+	Feedback *nostr.Event
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("job failed: %s", feedbackInfo(e.Feedback))
+}
+
+// Event builds the unsigned job request event.
+func (r JobRequest) Event() *nostr.Event {
+	event := &nostr.Event{
+		Kind:      r.Kind,
+		CreatedAt: nostr.Now(),
+		Content:   r.Content,
+		Tags:      [][]string{},
+	}
+	for _, input := range r.Inputs {
+		event.Tags = append(event.Tags, []string{"i", input.Data, input.Type})
+	}
+	names := make([]string, 0, len(r.Params))
+	for name := range r.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		event.Tags = append(event.Tags, []string{"param", name, r.Params[name]})
+	}
+	if r.Output != "" {
+		event.Tags = append(event.Tags, []string{"output", r.Output})
+	}
+	event.Tags = append(event.Tags, r.Tags...)
+	return event
+}
+
+// SubmitJob publishes a job request and waits for its result. Feedback and
+// results are picked up both from a subscription on the request ID and from
+// events the relay sends straight to this connection. A feedback event with
+// status "error" ends the wait with a JobError.
+func (c *Client) SubmitJob(ctx context.Context, req JobRequest) (*JobResponse, error) {
+	request := req.Event()
+	if c.opts.SecretKey != "" {
+		err := request.Sign(c.opts.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		request.ID = request.ComputeID()
+	}
+
+	response := &JobResponse{Request: request}
+	resultKind := req.Kind + 1000
+	done := make(chan error, 1)
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	finished := false
+
+	handle := func(event *nostr.Event) {
+		if event.Kind != resultKind && event.Kind != KindJobFeedback {
+			return
+		}
+		if !referencesEvent(event, request.ID) {
+			return
+		}
+		mu.Lock()
+		if finished || (event.ID != "" && seen[event.ID]) {
+			mu.Unlock()
+			return
+		}
+		seen[event.ID] = true
+		if event.Kind == resultKind {
+			response.Result = event
+			finished = true
+			mu.Unlock()
+			done <- nil
+			return
+		}
+		response.Feedback = append(response.Feedback, event)
+		failed := feedbackStatus(event) == "error"
+		finished = failed
+		mu.Unlock()
+
+		if req.OnFeedback != nil {
+			req.OnFeedback(event)
+		}
+		if failed {
+			done <- &JobError{Feedback: event}
+		}
+	}
+
+	unregister := c.onDirect(handle)
+	defer unregister()
+	sub, err := c.Subscribe(ctx, []*nostr.Filter{{
+		Kinds: []int{resultKind, KindJobFeedback},
+		Tags:  map[string][]string{"e": {request.ID}},
+	}}, Callbacks{OnEvent: handle})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+
+	err = c.Publish(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	finished = true
+	return response, err
+}
+
+func referencesEvent(event *nostr.Event, id string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "e" && tag[1] == id {
+			return true
+		}
+	}
+	return false
+}
+
+func feedbackStatus(event *nostr.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "status" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func feedbackInfo(event *nostr.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "status" && tag[2] != "" {
+			return tag[2]
+		}
+	}
+	if event.Content != "" {
+		return event.Content
+	}
+	return "no details given"
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openagentsinc/v3/relay/internal/lru"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// seenSize bounds the event IDs a subscription remembers to skip events the
+// relay resends after a reconnect.
+const seenSize = 10000
+
+// Callbacks receive a subscription's traffic. They run on the client's read
+// goroutine, so they must not block. Any of them may be nil.
+type Callbacks struct {
+	OnEvent func(*nostr.Event)
+	// OnEOSE is called once stored events have been sent. After a reconnect
+	// the relay resends stored events, but OnEOSE is not called again.
+	OnEOSE func()
+	// OnClosed is called when the relay or the client ends the subscription.
+	// A CLOSED with an "error:" reason is not final: the subscription is
+	// reopened the next time the client reconnects.
+	OnClosed func(reason string)
+}
+
+type Subscription struct {
+	ID      string
+	Filters []*nostr.Filter
+
+	client    *Client
+	callbacks Callbacks
+	eoseOnce  sync.Once
+	closeOnce sync.Once
+	seen      *lru.Cache
+	mu        sync.Mutex
+}
+
+// Subscribe opens a REQ for filters. The subscription survives reconnects
+// until Close is called or the relay closes it.
+func (c *Client) Subscribe(ctx context.Context, filters []*nostr.Filter, callbacks Callbacks) (*Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		ID:        c.newSubscriptionID(),
+		Filters:   filters,
+		client:    c,
+		callbacks: callbacks,
+		seen:      lru.New(seenSize),
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c.subs[sub.ID] = sub
+	c.mu.Unlock()
+
+	// While disconnected the REQ is sent by reconnect
+	err := c.write(sub.request())
+	if err != nil && err != ErrDisconnected {
+		c.mu.Lock()
+		delete(c.subs, sub.ID)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Close sends CLOSE for the subscription.
+func (s *Subscription) Close() {
+	c := s.client
+	c.mu.Lock()
+	_, open := c.subs[s.ID]
+	delete(c.subs, s.ID)
+	c.mu.Unlock()
+	if !open {
+		return
+	}
+
+	err := c.write([]interface{}{"CLOSE", s.ID})
+	if err != nil && err != ErrDisconnected && err != ErrClosed {
+		c.log.Warn("Error closing subscription", "sub_id", s.ID, "error", err)
+	}
+	s.close("")
+}
+
+func (s *Subscription) request() []interface{} {
+	req := make([]interface{}, 0, len(s.Filters)+2)
+	req = append(req, "REQ", s.ID)
+	for _, filter := range s.Filters {
+		req = append(req, filterJSON(filter))
+	}
+	return req
+}
+
+// event delivers an event once, even when it is resent after a reconnect.
+func (s *Subscription) event(event *nostr.Event) {
+	if event.ID != "" {
+		s.mu.Lock()
+		seen := s.seen.Contains(event.ID)
+		s.seen.Add(event.ID, struct{}{})
+		s.mu.Unlock()
+		if seen {
+			return
+		}
+	}
+	if s.callbacks.OnEvent != nil {
+		s.callbacks.OnEvent(event)
+	}
+}
+
+func (s *Subscription) eose() {
+	s.eoseOnce.Do(func() {
+		if s.callbacks.OnEOSE != nil {
+			s.callbacks.OnEOSE()
+		}
+	})
+}
+
+func (s *Subscription) close(reason string) {
+	s.closeOnce.Do(func() {
+		if s.callbacks.OnClosed != nil {
+			s.callbacks.OnClosed(reason)
+		}
+	})
+}
+
+// filterJSON encodes a filter including its "#x" tag conditions, which
+// nostr.Filter does not marshal itself.
+func filterJSON(filter *nostr.Filter) map[string]interface{} {
+	m := make(map[string]interface{})
+	if len(filter.IDs) > 0 {
+		m["ids"] = filter.IDs
+	}
+	if len(filter.Authors) > 0 {
+		m["authors"] = filter.Authors
+	}
+	if len(filter.Kinds) > 0 {
+		m["kinds"] = filter.Kinds
+	}
+	if filter.Since != 0 {
+		m["since"] = filter.Since
+	}
+	if filter.Until != 0 {
+		m["until"] = filter.Until
+	}
+	if filter.Limit > 0 {
+		m["limit"] = filter.Limit
+	}
+	if filter.Search != "" {
+		m["search"] = filter.Search
+	}
+	for name, values := range filter.Tags {
+		m["#"+name] = values
+	}
+	return m
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/internal/lru"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+func TestSubscriptionForgetsOldEventIDs(t *testing.T) {
+	var got []string
+	sub := &Subscription{
+		seen:      lru.New(2),
+		callbacks: Callbacks{OnEvent: func(event *nostr.Event) { got = append(got, event.ID) }},
+	}
+	for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+		sub.event(&nostr.Event{ID: id})
+	}
+	// "b" was pushed out by "c" and "a", so its resend is delivered again
+	if want := []string{"a", "b", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/client"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+const usage = `usage: nah [flags] <command> [args]
+
+Commands:
+  keygen                          generate a secret key
+  publish [-kind n] [-tag k,v...] content
+                                  publish an event and wait for OK
+  req [-kind n] [-author hex] [-tag k,v] [-limit n] [-search text] [-follow]
+                                  print stored events matching a filter
+  transcribe file                 submit an audio file for speech-to-text (kind 5252)
+  ask -repo owner/name prompt     ask a question about a repository (kind 5838)
+
+Flags:
+`
+
+type options struct {
+	relay     string
+	secretKey string
+	timeout   time.Duration
+	verbose   bool
+}
+
+func main() {
+	log.SetFlags(0)
+	var opts options
+	flag.StringVar(&opts.relay, "relay", envOr("NAH_RELAY", "ws://localhost:8080"), "Relay websocket URL")
+	flag.StringVar(&opts.secretKey, "key", os.Getenv("NAH_SECRET_KEY"), "Hex secret key to sign events with (default $NAH_SECRET_KEY, or a throwaway key)")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "How long to wait for the relay (0 waits forever)")
+	flag.BoolVar(&opts.verbose, "v", false, "Log connection details")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	level := logging.LevelWarn
+	if opts.verbose {
+		level = logging.LevelDebug
+	}
+	logging.SetDefault(logging.New(os.Stderr, level, false))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	args := flag.Args()
+	var err error
+	switch args[0] {
+	case "keygen":
+		err = keygen()
+	case "publish":
+		err = publish(ctx, opts, args[1:])
+	case "req":
+		err = req(ctx, opts, args[1:])
+	case "transcribe":
+		err = transcribe(ctx, opts, args[1:])
+	case "ask":
+		err = ask(ctx, opts, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal("Error: ", err)
+	}
+}
+
+func keygen() error {
+	secretKey, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+	publicKey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("secret key: %s\npublic key: %s\n", secretKey, publicKey)
+	return nil
+}
+
+func publish(ctx context.Context, opts options, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	kind := fs.Int("kind", 1, "Event kind")
+	var tags tagList
+	fs.Var(&tags, "tag", "Tag as comma separated values, e.g. e,<id> (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("publish takes the event content as its only argument")
+	}
+
+	c, ctx, cancel, err := dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer c.Close()
+
+	event := &nostr.Event{
+		Kind:      *kind,
+		CreatedAt: nostr.Now(),
+		Tags:      [][]string(tags),
+		Content:   fs.Arg(0),
+	}
+	if event.Tags == nil {
+		event.Tags = [][]string{}
+	}
+	err = c.Publish(ctx, event)
+	if err != nil {
+		return err
+	}
+	fmt.Println(event.ID)
+	return nil
+}
+
+func req(ctx context.Context, opts options, args []string) error {
+	fs := flag.NewFlagSet("req", flag.ExitOnError)
+	var kinds intList
+	var authors, ids stringList
+	var tags tagList
+	fs.Var(&kinds, "kind", "Event kind (repeatable)")
+	fs.Var(&authors, "author", "Author pubkey (repeatable)")
+	fs.Var(&ids, "id", "Event ID (repeatable)")
+	fs.Var(&tags, "tag", "Tag condition as name,value[,value...] (repeatable)")
+	limit := fs.Int("limit", 0, "Maximum number of stored events")
+	search := fs.String("search", "", "NIP-50 search query")
+	follow := fs.Bool("follow", false, "Keep printing new events after stored ones")
+	fs.Parse(args)
+	if *follow {
+		opts.timeout = 0
+	}
+
+	filter := &nostr.Filter{
+		IDs:     ids,
+		Authors: authors,
+		Kinds:   kinds,
+		Limit:   *limit,
+		Search:  *search,
+	}
+	for _, tag := range tags {
+		if len(tag) < 2 {
+			return fmt.Errorf("tag condition %q needs a name and a value", strings.Join(tag, ","))
+		}
+		if filter.Tags == nil {
+			filter.Tags = make(map[string][]string)
+		}
+		filter.Tags[tag[0]] = append(filter.Tags[tag[0]], tag[1:]...)
+	}
+
+	c, ctx, cancel, err := dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer c.Close()
+
+	done := make(chan string, 1)
+	finish := func(reason string) {
+		select {
+		case done <- reason:
+		default:
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	_, err = c.Subscribe(ctx, []*nostr.Filter{filter}, client.Callbacks{
+		OnEvent: func(event *nostr.Event) {
+			_ = encoder.Encode(event)
+		},
+		OnEOSE: func() {
+			if !*follow {
+				finish("")
+			}
+		},
+		OnClosed: finish,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case reason := <-done:
+		if reason != "" {
+			return fmt.Errorf("subscription closed: %s", reason)
+		}
+		return nil
+	case <-ctx.Done():
+		if *follow {
+			return nil
+		}
+		return ctx.Err()
+	}
+}
+
+func transcribe(ctx context.Context, opts options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("transcribe takes an audio file as its only argument")
+	}
+	audio, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read audio file: %v", err)
+	}
+	format := strings.TrimPrefix(filepath.Ext(args[0]), ".")
+
+	return submit(ctx, opts, client.JobRequest{
+		Kind:   5252,
+		Inputs: []client.JobInput{{Data: base64.StdEncoding.EncodeToString(audio), Type: "text"}},
+		Params: map[string]string{"format": format},
+		Output: "text/plain",
+		Tags:   [][]string{{"bid", "0"}},
+	})
+}
+
+func ask(ctx context.Context, opts options, args []string) error {
+	fs := flag.NewFlagSet("ask", flag.ExitOnError)
+	repo := fs.String("repo", "", "Repository as owner/name or a GitHub URL")
+	fs.Parse(args)
+	if *repo == "" || fs.NArg() != 1 {
+		return fmt.Errorf("usage: nah ask -repo owner/name \"prompt\"")
+	}
+
+	return submit(ctx, opts, client.JobRequest{
+		Kind:   5838,
+		Inputs: []client.JobInput{{Data: fs.Arg(0), Type: "text"}},
+		Params: map[string]string{"repo": *repo},
+		Output: "text/plain",
+		Tags:   [][]string{{"bid", "0"}, {"t", "agent_command"}},
+	})
+}
+
+// submit runs a job, printing feedback, including partial output, to stderr
+// as it arrives and the result content to stdout.
+func submit(ctx context.Context, opts options, job client.JobRequest) error {
+	c, ctx, cancel, err := dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer c.Close()
+
+	streaming := false
+	job.OnFeedback = func(event *nostr.Event) {
+		status, info := "", ""
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "status" {
+				status = tag[1]
+				if len(tag) >= 3 {
+					info = tag[2]
+				}
+			}
+		}
+		// Partial feedback carries the answer as it is generated
+		if status == "partial" {
+			streaming = true
+			fmt.Fprint(os.Stderr, event.Content)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", status, info)
+	}
+	response, err := c.SubmitJob(ctx, job)
+	if streaming {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(response.Result.Content)
+	return nil
+}
+
+// dial connects to the relay and returns a context bounded by -timeout, or
+// unbounded when the timeout is zero.
+func dial(ctx context.Context, opts options) (*client.Client, context.Context, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	secretKey := opts.secretKey
+	if secretKey == "" {
+		// The relay only accepts signed events, so sign with a throwaway key
+		var err error
+		secretKey, err = nostr.GeneratePrivateKey()
+		if err != nil {
+			cancel()
+			return nil, nil, nil, err
+		}
+	}
+	c, err := client.Dial(ctx, opts.relay, client.Options{SecretKey: secretKey})
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	return c, ctx, cancel, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// tagList collects repeated -tag flags, each a comma separated tag.
+type tagList [][]string
+
+func (t *tagList) String() string {
+	return fmt.Sprint([][]string(*t))
+}
+
+func (t *tagList) Set(value string) error {
+	*t = append(*t, strings.Split(value, ","))
+	return nil
+}
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type intList []int
+
+func (l *intList) String() string {
+	return fmt.Sprint([]int(*l))
+}
+
+func (l *intList) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", value)
+	}
+	*l = append(*l, n)
+	return nil
+}
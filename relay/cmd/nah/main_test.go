@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/config"
+	"github.com/openagentsinc/v3/relay/internal/nip01"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// testOptions returns options for a relay with fake model backends.
+func testOptions(t *testing.T) options {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Relay.DataDir = t.TempDir()
+	cfg.Services = map[int]config.ServiceConfig{5252: {Backend: config.BackendFake}}
+	relay := nip01.NewRelay(cfg)
+	server := httptest.NewServer(http.HandlerFunc(relay.HandleWebSocket))
+	t.Cleanup(func() {
+		server.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = relay.Shutdown(ctx)
+	})
+	return options{relay: "ws" + strings.TrimPrefix(server.URL, "http"), timeout: 10 * time.Second}
+}
+
+// stdout returns what run prints to standard output.
+func stdout(t *testing.T, run func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	err = run()
+	os.Stdout = saved
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+func TestPublishAndReq(t *testing.T) {
+	opts := testOptions(t)
+	ctx := context.Background()
+	id := strings.TrimSpace(stdout(t, func() error {
+		return publish(ctx, opts, []string{"-tag", "t,nah", "hello"})
+	}))
+
+	out := stdout(t, func() error {
+		return req(ctx, opts, []string{"-kind", "1", "-tag", "t,nah"})
+	})
+	var event nostr.Event
+	err := json.Unmarshal([]byte(out), &event)
+	if err != nil {
+		t.Fatalf("req printed %q: %v", out, err)
+	}
+	if event.ID != id || event.Content != "hello" || !event.CheckSignature() {
+		t.Errorf("req printed %+v, want the published event %s", event, id)
+	}
+}
+
+func TestTranscribe(t *testing.T) {
+	opts := testOptions(t)
+	path := filepath.Join(t.TempDir(), "memo.wav")
+	err := os.WriteFile(path, []byte("RIFF"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := stdout(t, func() error {
+		return transcribe(context.Background(), opts, []string{path})
+	})
+	if strings.TrimSpace(out) != "Fake transcription of 4 bytes of wav audio" {
+		t.Errorf("transcribe printed %q", out)
+	}
+}
+
+func TestInvalidArgumentsAreRefusedBeforeDialing(t *testing.T) {
+	// Nothing listens here, so a dial would fail with another error
+	opts := options{relay: "ws://127.0.0.1:1", timeout: time.Second}
+	ctx := context.Background()
+	tests := map[string]func() error{
+		"publish without content": func() error { return publish(ctx, opts, nil) },
+		"req with a bare tag":     func() error { return req(ctx, opts, []string{"-tag", "t"}) },
+		"ask without repo":        func() error { return ask(ctx, opts, []string{"what is this?"}) },
+		"transcribe two files":    func() error { return transcribe(ctx, opts, []string{"a.wav", "b.wav"}) },
+	}
+	for name, run := range tests {
+		err := run()
+		if err == nil || strings.Contains(err.Error(), "127.0.0.1") {
+			t.Errorf("%s: got %v, want an argument error", name, err)
+		}
+	}
+}
+
+func TestFlagLists(t *testing.T) {
+	var tags tagList
+	_ = tags.Set("e,abc")
+	_ = tags.Set("p,def,wss://relay.example.com")
+	if len(tags) != 2 || len(tags[1]) != 3 || tags[1][2] != "wss://relay.example.com" {
+		t.Errorf("tags = %v", tags)
+	}
+
+	var kinds intList
+	if err := kinds.Set("5252"); err != nil || len(kinds) != 1 || kinds[0] != 5252 {
+		t.Errorf("kinds = %v, %v", kinds, err)
+	}
+	if err := kinds.Set("five"); err == nil {
+		t.Error("non-numeric kind accepted")
+	}
+}
@@ -1,37 +1,102 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"runtime"
+	"os/signal"
+	"syscall"
 
+	"github.com/openagentsinc/v3/relay/internal/config"
+	"github.com/openagentsinc/v3/relay/internal/logging"
 	"github.com/openagentsinc/v3/relay/internal/nip01"
 )
 
-func init() {
-	// Change the working directory to the project root
-	_, filename, _, _ := runtime.Caller(0)
-	dir := filepath.Join(filepath.Dir(filename), "../..")
-	err := os.Chdir(dir)
+const usage = "usage: relay [flags] [config print]"
+
+// errUsage is returned for an unknown command.
+var errUsage = errors.New(usage)
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	if err != nil {
-		log.Fatal(err)
+		logging.Default().Error("Error running relay", "error", err)
+		os.Exit(1)
 	}
 }
 
-func main() {
+// run starts the relay, or runs the command given after the flags. Commands
+// only read the config and leave the data directory untouched.
+func run(args []string, stdout io.Writer) error {
 	// Parse command-line flags
-	addr := flag.String("addr", ":8080", "HTTP service address")
-	flag.Parse()
+	flags := flag.NewFlagSet("relay", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("RELAY_CONFIG"), "Path to a YAML config file")
+	addr := flags.String("addr", "", "HTTP service address (overrides relay.addr)")
+	dataDir := flags.String("data-dir", "", "Directory for relay state (overrides relay.data_dir)")
+	_ = flags.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	if *addr != "" {
+		cfg.Relay.Addr = *addr
+	}
+	if *dataDir != "" {
+		cfg.Relay.DataDir = *dataDir
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	logging.SetDefault(cfg.Logger())
+	logger := logging.Default()
+
+	if flags.NArg() > 0 {
+		return runCommand(cfg, flags.Args(), stdout)
+	}
+
+	err = cfg.PrepareDataDir()
+	if err != nil {
+		return fmt.Errorf("failed to prepare data directory: %v", err)
+	}
+	err = cfg.PrepareProviderKey()
+	if err != nil {
+		return fmt.Errorf("failed to prepare provider key: %v", err)
+	}
 
 	// Initialize the relay
-	relay := nip01.NewRelay()
+	relay := nip01.NewRelay(cfg)
+
+	// Run the WebSocket server until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Start the WebSocket server
-	log.Printf("Starting relay server on %s", *addr)
-	err := relay.Start(*addr)
+	logger.Info("Starting relay server", "addr", cfg.Relay.Addr, "data_dir", cfg.Relay.DataDir)
+	err = relay.Run(ctx, cfg.Relay.Addr)
 	if err != nil {
-		log.Fatal("Error starting server:", err)
+		return fmt.Errorf("failed to run server: %v", err)
+	}
+	return nil
+}
+
+func runCommand(cfg *config.Config, args []string, stdout io.Writer) error {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			return fmt.Errorf("failed to print config: %v", err)
+		}
+		_, err = stdout.Write(out)
+		return err
+	default:
+		return fmt.Errorf("unknown command %v: %w", args, errUsage)
 	}
 }
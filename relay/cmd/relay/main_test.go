@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigPrintLeavesDataDirUntouched(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	var out bytes.Buffer
+	err := run([]string{"-config", "", "-data-dir", dir, "config", "print"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "data_dir: "+dir) {
+		t.Errorf("config print wrote:\n%s", out.String())
+	}
+	_, err = os.Stat(dir)
+	if !os.IsNotExist(err) {
+		t.Errorf("config print created the data directory: %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	err := run([]string{"-config", "", "-data-dir", t.TempDir(), "serve"}, &bytes.Buffer{})
+	if !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want a usage error", err)
+	}
+}
@@ -2,4 +2,8 @@ module github.com/openagentsinc/v3/relay
 
 go 1.16
 
-require github.com/gorilla/websocket v1.5.0
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2
+	github.com/gorilla/websocket v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
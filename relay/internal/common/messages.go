@@ -1,9 +1,33 @@
 package common
 
 import (
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
 func CreateEventMessage(event *nostr.Event) []interface{} {
 	return []interface{}{"EVENT", event}
-}
\ No newline at end of file
+}
+
+func CreateSubscriptionEventMessage(subscriptionID string, event *nostr.Event) []interface{} {
+	return []interface{}{"EVENT", subscriptionID, event}
+}
+
+func CreateEOSEMessage(subscriptionID string) []interface{} {
+	return []interface{}{"EOSE", subscriptionID}
+}
+
+func CreateOKMessage(eventID string, accepted bool, message string) []interface{} {
+	return []interface{}{"OK", eventID, accepted, message}
+}
+
+func CreateCountMessage(subscriptionID string, count int) []interface{} {
+	return []interface{}{"COUNT", subscriptionID, map[string]int{"count": count}}
+}
+
+func CreateNoticeMessage(message string) []interface{} {
+	return []interface{}{"NOTICE", message}
+}
+
+func CreateClosedMessage(subscriptionID string, message string) []interface{} {
+	return []interface{}{"CLOSED", subscriptionID, message}
+}
@@ -0,0 +1,456 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every tunable of the relay. Values are layered: built-in
+// defaults, then the YAML config file, then environment variables, then
+// command-line flags.
+type Config struct {
+	Relay    RelayConfig           `yaml:"relay"`
+	Groq     GroqConfig            `yaml:"groq"`
+	OpenAI   OpenAIConfig          `yaml:"openai"`
+	GitHub   GitHubConfig          `yaml:"github"`
+	Agent    AgentConfig           `yaml:"agent"`
+	Log      LogConfig             `yaml:"log"`
+	Provider ProviderConfig        `yaml:"provider"`
+	Services map[int]ServiceConfig `yaml:"services,omitempty"`
+}
+
+type RelayConfig struct {
+	Addr string `yaml:"addr"`
+	// DataDir holds everything the relay writes to disk. Relative paths are
+	// resolved against the working directory at startup.
+	DataDir            string `yaml:"data_dir"`
+	SubscriptionBuffer int    `yaml:"subscription_buffer"`
+	// SlowConsumerPolicy is applied when a subscription buffer is full:
+	// drop-oldest, disconnect or spill.
+	SlowConsumerPolicy string `yaml:"slow_consumer_policy"`
+	// OverflowBuffer caps the per-subscription spill buffer.
+	OverflowBuffer int `yaml:"overflow_buffer"`
+	JobWorkers     int `yaml:"job_workers"`
+	JobQueueSize   int `yaml:"job_queue_size"`
+	// ShutdownTimeout bounds, in seconds, how long shutdown waits for
+	// in-flight jobs before persisting them.
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// MaxMessageLength caps a client frame in bytes. Audio job requests
+	// carry the recording inline, so it is generous.
+	MaxMessageLength int `yaml:"max_message_length"`
+	// MaxFilters caps the filters in one REQ or COUNT.
+	MaxFilters int `yaml:"max_filters"`
+}
+
+type GroqConfig struct {
+	APIKey             string  `yaml:"api_key"`
+	BaseURL            string  `yaml:"base_url"`
+	ChatModel          string  `yaml:"chat_model"`
+	TranscriptionModel string  `yaml:"transcription_model"`
+	Temperature        float64 `yaml:"temperature"`
+	MaxTokens          int     `yaml:"max_tokens"`
+	// Timeout bounds, in seconds, each API request attempt.
+	Timeout int `yaml:"timeout"`
+	// MaxRetries is how often rate-limited, failed server and network
+	// requests are repeated.
+	MaxRetries int `yaml:"max_retries"`
+}
+
+// OpenAIConfig points the openai backend at any OpenAI-compatible server,
+// such as OpenAI itself, Ollama or llama.cpp.
+type OpenAIConfig struct {
+	APIKey             string  `yaml:"api_key"`
+	BaseURL            string  `yaml:"base_url"`
+	ChatModel          string  `yaml:"chat_model"`
+	TranscriptionModel string  `yaml:"transcription_model"`
+	Temperature        float64 `yaml:"temperature"`
+	MaxTokens          int     `yaml:"max_tokens"`
+	Timeout            int     `yaml:"timeout"`
+	MaxRetries         int     `yaml:"max_retries"`
+}
+
+type GitHubConfig struct {
+	Token   string `yaml:"token"`
+	BaseURL string `yaml:"base_url"`
+}
+
+type AgentConfig struct {
+	MaxIterations int `yaml:"max_iterations"`
+	MaxWords      int `yaml:"max_words"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// ProviderConfig is the identity the NIP-90 services publish under.
+type ProviderConfig struct {
+	// SecretKey signs job results and feedback. When empty, a key is
+	// generated once and kept in the data directory.
+	SecretKey string `yaml:"secret_key"`
+	// PublishAttempts bounds how often a result is sent to each relay named
+	// in a request's relays tag before giving up.
+	PublishAttempts int `yaml:"publish_attempts"`
+	// PublishAllow, when set, limits those relays to the listed hosts, which
+	// may then be on a private network. Otherwise only hosts that resolve
+	// to public addresses are used.
+	PublishAllow []string `yaml:"publish_allow,omitempty"`
+	// PublishDeny lists hosts results are never published to.
+	PublishDeny []string `yaml:"publish_deny,omitempty"`
+	// MaxPublishRelays bounds how many relays results are published to at
+	// once.
+	MaxPublishRelays int `yaml:"max_publish_relays"`
+	// Relays are upstream relays watched for job requests. Empty disables
+	// provider mode.
+	Relays []string `yaml:"relays,omitempty"`
+	// MentionsOnly limits provider mode to requests p-tagging our pubkey.
+	MentionsOnly bool `yaml:"mentions_only"`
+}
+
+// Model backends a service can run on.
+const (
+	BackendGroq   = "groq"
+	BackendOpenAI = "openai"
+	BackendFake   = "fake"
+)
+
+// ServiceConfig overrides settings of the NIP-90 service with the same kind.
+type ServiceConfig struct {
+	MinPowDifficulty int `yaml:"min_pow_difficulty"`
+	// Backend is the model provider the service uses: groq (the default),
+	// openai or fake.
+	Backend string `yaml:"backend,omitempty"`
+}
+
+func Default() *Config {
+	return &Config{
+		Relay: RelayConfig{
+			Addr:               ":8080",
+			DataDir:            DefaultDataDir(),
+			SubscriptionBuffer: 100,
+			SlowConsumerPolicy: "drop-oldest",
+			OverflowBuffer:     1000,
+			JobWorkers:         4,
+			JobQueueSize:       100,
+			ShutdownTimeout:    30,
+			MaxMessageLength:   8 << 20,
+			MaxFilters:         10,
+		},
+		Groq: GroqConfig{
+			BaseURL:            "https://api.groq.com/openai/v1",
+			ChatModel:          "llama3-groq-70b-8192-tool-use-preview",
+			TranscriptionModel: "distil-whisper-large-v3-en",
+			Temperature:        0.7,
+			MaxTokens:          4096,
+			Timeout:            60,
+			MaxRetries:         3,
+		},
+		OpenAI: OpenAIConfig{
+			BaseURL:            "http://localhost:11434/v1",
+			ChatModel:          "llama3.1",
+			TranscriptionModel: "whisper-1",
+			Temperature:        0.7,
+			MaxTokens:          4096,
+			Timeout:            60,
+			MaxRetries:         3,
+		},
+		GitHub: GitHubConfig{
+			BaseURL: "https://api.github.com",
+		},
+		Agent: AgentConfig{
+			MaxIterations: 5,
+			MaxWords:      75,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Provider: ProviderConfig{
+			PublishAttempts:  5,
+			MaxPublishRelays: 100,
+		},
+	}
+}
+
+// Load returns the defaults overlaid with the file at path (if any) and the
+// environment.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		err = yaml.Unmarshal(data, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+		}
+	}
+
+	err := cfg.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() error {
+	setString(&c.Relay.Addr, "RELAY_ADDR")
+	setString(&c.Relay.DataDir, "RELAY_DATA_DIR")
+	setString(&c.Relay.SlowConsumerPolicy, "RELAY_SLOW_CONSUMER_POLICY")
+	setString(&c.Groq.APIKey, "GROQ_API_KEY")
+	setString(&c.Groq.BaseURL, "RELAY_GROQ_BASE_URL")
+	setString(&c.Groq.ChatModel, "RELAY_GROQ_CHAT_MODEL")
+	setString(&c.Groq.TranscriptionModel, "RELAY_GROQ_TRANSCRIPTION_MODEL")
+	setString(&c.OpenAI.APIKey, "RELAY_OPENAI_API_KEY")
+	setString(&c.OpenAI.BaseURL, "RELAY_OPENAI_BASE_URL")
+	setString(&c.OpenAI.ChatModel, "RELAY_OPENAI_CHAT_MODEL")
+	setString(&c.OpenAI.TranscriptionModel, "RELAY_OPENAI_TRANSCRIPTION_MODEL")
+	setString(&c.GitHub.Token, "GITHUB_TOKEN")
+	setString(&c.GitHub.BaseURL, "RELAY_GITHUB_BASE_URL")
+	setString(&c.Log.Level, "RELAY_LOG_LEVEL")
+	setString(&c.Log.Format, "RELAY_LOG_FORMAT")
+	setString(&c.Provider.SecretKey, "RELAY_PROVIDER_SECRET_KEY")
+
+	ints := map[string]*int{
+		"RELAY_SUBSCRIPTION_BUFFER":         &c.Relay.SubscriptionBuffer,
+		"RELAY_OVERFLOW_BUFFER":             &c.Relay.OverflowBuffer,
+		"RELAY_JOB_WORKERS":                 &c.Relay.JobWorkers,
+		"RELAY_JOB_QUEUE_SIZE":              &c.Relay.JobQueueSize,
+		"RELAY_SHUTDOWN_TIMEOUT":            &c.Relay.ShutdownTimeout,
+		"RELAY_MAX_MESSAGE_LENGTH":          &c.Relay.MaxMessageLength,
+		"RELAY_MAX_FILTERS":                 &c.Relay.MaxFilters,
+		"RELAY_GROQ_MAX_TOKENS":             &c.Groq.MaxTokens,
+		"RELAY_GROQ_TIMEOUT":                &c.Groq.Timeout,
+		"RELAY_GROQ_MAX_RETRIES":            &c.Groq.MaxRetries,
+		"RELAY_OPENAI_MAX_TOKENS":           &c.OpenAI.MaxTokens,
+		"RELAY_OPENAI_TIMEOUT":              &c.OpenAI.Timeout,
+		"RELAY_OPENAI_MAX_RETRIES":          &c.OpenAI.MaxRetries,
+		"RELAY_AGENT_MAX_ITERATIONS":        &c.Agent.MaxIterations,
+		"RELAY_AGENT_MAX_WORDS":             &c.Agent.MaxWords,
+		"RELAY_PROVIDER_PUBLISH_ATTEMPTS":   &c.Provider.PublishAttempts,
+		"RELAY_PROVIDER_MAX_PUBLISH_RELAYS": &c.Provider.MaxPublishRelays,
+	}
+	for name, target := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*target = parsed
+		}
+	}
+
+	if value, ok := os.LookupEnv("RELAY_PROVIDER_RELAYS"); ok {
+		c.Provider.Relays = splitList(value)
+	}
+	if value, ok := os.LookupEnv("RELAY_PROVIDER_PUBLISH_ALLOW"); ok {
+		c.Provider.PublishAllow = splitList(value)
+	}
+	if value, ok := os.LookupEnv("RELAY_PROVIDER_PUBLISH_DENY"); ok {
+		c.Provider.PublishDeny = splitList(value)
+	}
+	if value, ok := os.LookupEnv("RELAY_PROVIDER_MENTIONS_ONLY"); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid RELAY_PROVIDER_MENTIONS_ONLY: %v", err)
+		}
+		c.Provider.MentionsOnly = parsed
+	}
+
+	floats := map[string]*float64{
+		"RELAY_GROQ_TEMPERATURE":   &c.Groq.Temperature,
+		"RELAY_OPENAI_TEMPERATURE": &c.OpenAI.Temperature,
+	}
+	for name, target := range floats {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*target = parsed
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated environment value, dropping blanks.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func setString(target *string, name string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*target = value
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.Relay.Addr == "" {
+		return fmt.Errorf("relay.addr must not be empty")
+	}
+	if c.Relay.DataDir == "" {
+		return fmt.Errorf("relay.data_dir must not be empty")
+	}
+	if c.Relay.SubscriptionBuffer <= 0 {
+		return fmt.Errorf("relay.subscription_buffer must be positive")
+	}
+	switch c.Relay.SlowConsumerPolicy {
+	case "drop-oldest", "disconnect", "spill":
+	default:
+		return fmt.Errorf("relay.slow_consumer_policy must be drop-oldest, disconnect or spill")
+	}
+	if c.Relay.OverflowBuffer <= 0 {
+		return fmt.Errorf("relay.overflow_buffer must be positive")
+	}
+	if c.Relay.JobWorkers <= 0 || c.Relay.JobQueueSize <= 0 {
+		return fmt.Errorf("relay.job_workers and relay.job_queue_size must be positive")
+	}
+	if c.Relay.ShutdownTimeout < 0 {
+		return fmt.Errorf("relay.shutdown_timeout must not be negative")
+	}
+	if c.Relay.MaxMessageLength <= 0 || c.Relay.MaxFilters <= 0 {
+		return fmt.Errorf("relay.max_message_length and relay.max_filters must be positive")
+	}
+	if err := validateURL("groq.base_url", c.Groq.BaseURL); err != nil {
+		return err
+	}
+	if c.Groq.ChatModel == "" || c.Groq.TranscriptionModel == "" {
+		return fmt.Errorf("groq.chat_model and groq.transcription_model must be set")
+	}
+	if c.Groq.Temperature < 0 || c.Groq.Temperature > 2 {
+		return fmt.Errorf("groq.temperature must be between 0 and 2")
+	}
+	if c.Groq.MaxTokens <= 0 {
+		return fmt.Errorf("groq.max_tokens must be positive")
+	}
+	if c.Groq.Timeout <= 0 || c.Groq.MaxRetries < 0 {
+		return fmt.Errorf("groq.timeout must be positive and groq.max_retries not negative")
+	}
+	if err := validateURL("github.base_url", c.GitHub.BaseURL); err != nil {
+		return err
+	}
+	if c.Agent.MaxIterations <= 0 {
+		return fmt.Errorf("agent.max_iterations must be positive")
+	}
+	if c.Agent.MaxWords <= 0 {
+		return fmt.Errorf("agent.max_words must be positive")
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("log.level: %v", err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log.format must be text or json")
+	}
+	if c.Provider.SecretKey != "" {
+		if _, err := nostr.GetPublicKey(c.Provider.SecretKey); err != nil {
+			return fmt.Errorf("provider.secret_key: %v", err)
+		}
+	}
+	if c.Provider.PublishAttempts <= 0 || c.Provider.MaxPublishRelays <= 0 {
+		return fmt.Errorf("provider.publish_attempts and provider.max_publish_relays must be positive")
+	}
+	for _, relay := range c.Provider.Relays {
+		u, err := url.Parse(relay)
+		if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+			return fmt.Errorf("provider.relays: %q is not a ws:// or wss:// URL", relay)
+		}
+	}
+	for kind, service := range c.Services {
+		if kind < 5000 || kind > 5999 {
+			return fmt.Errorf("services.%d: not a NIP-90 job request kind", kind)
+		}
+		if service.MinPowDifficulty < 0 || service.MinPowDifficulty > 256 {
+			return fmt.Errorf("services.%d.min_pow_difficulty must be between 0 and 256", kind)
+		}
+		switch service.Backend {
+		case "", BackendGroq, BackendFake:
+		case BackendOpenAI:
+			if err := c.validateOpenAI(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("services.%d.backend must be groq, openai or fake", kind)
+		}
+	}
+	return nil
+}
+
+// validateOpenAI checks the openai settings, which only matter once a
+// service uses that backend.
+func (c *Config) validateOpenAI() error {
+	if err := validateURL("openai.base_url", c.OpenAI.BaseURL); err != nil {
+		return err
+	}
+	if c.OpenAI.ChatModel == "" && c.OpenAI.TranscriptionModel == "" {
+		return fmt.Errorf("openai.chat_model or openai.transcription_model must be set")
+	}
+	if c.OpenAI.Temperature < 0 || c.OpenAI.Temperature > 2 {
+		return fmt.Errorf("openai.temperature must be between 0 and 2")
+	}
+	if c.OpenAI.MaxTokens <= 0 {
+		return fmt.Errorf("openai.max_tokens must be positive")
+	}
+	if c.OpenAI.Timeout <= 0 || c.OpenAI.MaxRetries < 0 {
+		return fmt.Errorf("openai.timeout must be positive and openai.max_retries not negative")
+	}
+	return nil
+}
+
+// Backend returns the model backend configured for the service of kind.
+func (c *Config) Backend(kind int) string {
+	if service, ok := c.Services[kind]; ok && service.Backend != "" {
+		return service.Backend
+	}
+	return BackendGroq
+}
+
+func validateURL(name, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("%s must be an absolute URL, got %q", name, value)
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with secrets masked, for printing.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.Groq.APIKey != "" {
+		redacted.Groq.APIKey = "<redacted>"
+	}
+	if redacted.OpenAI.APIKey != "" {
+		redacted.OpenAI.APIKey = "<redacted>"
+	}
+	if redacted.GitHub.Token != "" {
+		redacted.GitHub.Token = "<redacted>"
+	}
+	if redacted.Provider.SecretKey != "" {
+		redacted.Provider.SecretKey = "<redacted>"
+	}
+	return &redacted
+}
+
+// Logger builds the logger described by the log settings.
+func (c *Config) Logger() *logging.Logger {
+	level, _ := logging.ParseLevel(c.Log.Level)
+	return logging.New(os.Stderr, level, c.Log.Format == "json")
+}
+
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
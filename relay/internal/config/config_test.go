@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setenv sets an environment variable for the duration of the test.
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+	previous, had := os.LookupEnv(name)
+	err := os.Setenv(name, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestLoadJobSettingsFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("relay:\n  job_workers: 2\n  job_queue_size: 50\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "RELAY_JOB_WORKERS", "8")
+	setenv(t, "RELAY_SHUTDOWN_TIMEOUT", "5")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Relay.JobWorkers != 8 {
+		t.Errorf("job_workers = %d, want the environment's 8", cfg.Relay.JobWorkers)
+	}
+	if cfg.Relay.JobQueueSize != 50 {
+		t.Errorf("job_queue_size = %d, want the file's 50", cfg.Relay.JobQueueSize)
+	}
+	if cfg.Relay.ShutdownTimeout != 5 {
+		t.Errorf("shutdown_timeout = %d, want 5", cfg.Relay.ShutdownTimeout)
+	}
+}
+
+func TestLoadRejectsInvalidEnv(t *testing.T) {
+	setenv(t, "RELAY_JOB_QUEUE_SIZE", "many")
+
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("expected an error for a non-numeric RELAY_JOB_QUEUE_SIZE")
+	}
+}
+
+func TestLoadPublishSettingsFromEnv(t *testing.T) {
+	setenv(t, "RELAY_PROVIDER_PUBLISH_ALLOW", "relay.example.com, 10.0.0.5")
+	setenv(t, "RELAY_PROVIDER_PUBLISH_DENY", "bad.example.com")
+	setenv(t, "RELAY_PROVIDER_MAX_PUBLISH_RELAYS", "20")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Provider.PublishAllow) != 2 || cfg.Provider.PublishAllow[1] != "10.0.0.5" {
+		t.Errorf("publish_allow = %q", cfg.Provider.PublishAllow)
+	}
+	if len(cfg.Provider.PublishDeny) != 1 || cfg.Provider.PublishDeny[0] != "bad.example.com" {
+		t.Errorf("publish_deny = %q", cfg.Provider.PublishDeny)
+	}
+	if cfg.Provider.MaxPublishRelays != 20 {
+		t.Errorf("max_publish_relays = %d, want 20", cfg.Provider.MaxPublishRelays)
+	}
+}
+
+func TestLoadProviderModeFromEnv(t *testing.T) {
+	setenv(t, "RELAY_PROVIDER_RELAYS", "wss://one.example.com, ,wss://two.example.com")
+	setenv(t, "RELAY_PROVIDER_MENTIONS_ONLY", "true")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Provider.Relays) != 2 || cfg.Provider.Relays[1] != "wss://two.example.com" {
+		t.Errorf("relays = %q", cfg.Provider.Relays)
+	}
+	if !cfg.Provider.MentionsOnly {
+		t.Error("mentions_only not set")
+	}
+
+	cfg.Provider.Relays = append(cfg.Provider.Relays, "https://three.example.com")
+	if cfg.Validate() == nil {
+		t.Error("expected an error for a non-websocket provider relay")
+	}
+}
+
+func TestLoadLayersDefaultsFileAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte("relay:\n  addr: :9000\n  slow_consumer_policy: spill\ngroq:\n  chat_model: from-file\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "RELAY_GROQ_CHAT_MODEL", "from-env")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Relay.Addr != ":9000" || cfg.Relay.SlowConsumerPolicy != "spill" {
+		t.Errorf("file settings not applied: addr %q, policy %q", cfg.Relay.Addr, cfg.Relay.SlowConsumerPolicy)
+	}
+	if cfg.Groq.ChatModel != "from-env" {
+		t.Errorf("chat_model = %q, want the environment's", cfg.Groq.ChatModel)
+	}
+	if cfg.Agent.MaxWords != Default().Agent.MaxWords {
+		t.Errorf("max_words = %d, want the default", cfg.Agent.MaxWords)
+	}
+	err = cfg.Validate()
+	if err != nil {
+		t.Errorf("layered config is invalid: %v", err)
+	}
+}
+
+func TestLoadRejectsUnreadableFile(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Load(filepath.Join(dir, "missing.yaml"))
+	if err == nil {
+		t.Error("expected an error for a missing config file")
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	err = os.WriteFile(path, []byte("relay: [not, a, map]\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(path)
+	if err == nil {
+		t.Error("expected an error for a malformed config file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]func(*Config){
+		"empty addr":        func(c *Config) { c.Relay.Addr = "" },
+		"unknown policy":    func(c *Config) { c.Relay.SlowConsumerPolicy = "ignore" },
+		"relative base_url": func(c *Config) { c.Groq.BaseURL = "/openai/v1" },
+		"temperature":       func(c *Config) { c.Groq.Temperature = 3 },
+		"log level":         func(c *Config) { c.Log.Level = "verbose" },
+		"provider relay":    func(c *Config) { c.Provider.Relays = []string{"https://relay.example.com"} },
+		"service kind":      func(c *Config) { c.Services = map[int]ServiceConfig{1: {}} },
+	}
+	for name, breakIt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			breakIt(cfg)
+			if cfg.Validate() == nil {
+				t.Error("invalid config was accepted")
+			}
+		})
+	}
+}
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Groq.APIKey = "gsk_hunter2"
+	cfg.GitHub.Token = "ghp_hunter2"
+
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "hunter2") {
+		t.Errorf("secrets printed:\n%s", out)
+	}
+	if cfg.Groq.APIKey != "gsk_hunter2" {
+		t.Error("redacting changed the original config")
+	}
+}
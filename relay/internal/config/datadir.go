@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+const appName = "openagents-relay"
+
+// providerKeyFileName holds the generated provider secret key, relative to
+// the data directory.
+const providerKeyFileName = "provider.key"
+
+// DefaultDataDir follows the XDG base directory spec: $XDG_DATA_HOME if set,
+// otherwise ~/.local/share. It falls back to a directory under the working
+// directory when no home directory is available.
+func DefaultDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".", "data")
+	}
+	return filepath.Join(home, ".local", "share", appName)
+}
+
+// DataPath resolves a path inside the data directory.
+func (c *Config) DataPath(elem ...string) string {
+	return filepath.Join(append([]string{c.Relay.DataDir}, elem...)...)
+}
+
+// PrepareDataDir makes the data directory absolute and creates it if needed.
+func (c *Config) PrepareDataDir() error {
+	dir, err := filepath.Abs(c.Relay.DataDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve data directory: %v", err)
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	c.Relay.DataDir = dir
+	return nil
+}
+
+// PrepareProviderKey fills in provider.secret_key when it is not configured,
+// from the key file in the data directory, generating the file on first use
+// so the services keep the same pubkey across restarts.
+func (c *Config) PrepareProviderKey() error {
+	if c.Provider.SecretKey != "" {
+		return nil
+	}
+	path := c.DataPath(providerKeyFileName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if _, err := nostr.GetPublicKey(key); err != nil {
+			return fmt.Errorf("invalid provider key in %s: %v", path, err)
+		}
+		c.Provider.SecretKey = key
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read provider key: %v", err)
+	}
+
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, []byte(key+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write provider key: %v", err)
+	}
+	c.Provider.SecretKey = key
+	return nil
+}
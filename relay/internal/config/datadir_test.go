@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+func TestDefaultDataDir(t *testing.T) {
+	home := t.TempDir()
+	setenv(t, "HOME", home)
+
+	setenv(t, "XDG_DATA_HOME", "/var/lib/xdg")
+	if got, want := DefaultDataDir(), filepath.Join("/var/lib/xdg", appName); got != want {
+		t.Errorf("with XDG_DATA_HOME: got %s, want %s", got, want)
+	}
+
+	setenv(t, "XDG_DATA_HOME", "")
+	if got, want := DefaultDataDir(), filepath.Join(home, ".local", "share", appName); got != want {
+		t.Errorf("without XDG_DATA_HOME: got %s, want %s", got, want)
+	}
+}
+
+func TestPrepareDataDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	cfg := Default()
+	cfg.Relay.DataDir = filepath.Join("state", "relay")
+	err = cfg.PrepareDataDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(cfg.Relay.DataDir) {
+		t.Errorf("data directory %s is not absolute", cfg.Relay.DataDir)
+	}
+	info, err := os.Stat(filepath.Join(dir, "state", "relay"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Mode().Perm() != 0o700 {
+		t.Errorf("data directory created with mode %v", info.Mode())
+	}
+}
+
+func TestPrepareProviderKey(t *testing.T) {
+	dir := t.TempDir()
+	first := Default()
+	first.Relay.DataDir = dir
+	err := first.PrepareProviderKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nostr.GetPublicKey(first.Provider.SecretKey); err != nil {
+		t.Fatalf("generated an invalid key: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, providerKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file created with mode %v", info.Mode())
+	}
+
+	// The next start reuses the key
+	second := Default()
+	second.Relay.DataDir = dir
+	err = second.PrepareProviderKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Provider.SecretKey != first.Provider.SecretKey {
+		t.Error("second start generated a new key")
+	}
+}
+
+func TestPrepareProviderKeyKeepsConfiguredKey(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Default()
+	cfg.Relay.DataDir = dir
+	cfg.Provider.SecretKey = "configured"
+	err := cfg.PrepareProviderKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Provider.SecretKey != "configured" {
+		t.Errorf("configured key replaced with %s", cfg.Provider.SecretKey)
+	}
+	if _, err := os.Stat(filepath.Join(dir, providerKeyFileName)); !os.IsNotExist(err) {
+		t.Errorf("key file written although a key is configured: %v", err)
+	}
+}
+
+func TestPrepareProviderKeyRejectsInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, providerKeyFileName), []byte("not a key\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Default()
+	cfg.Relay.DataDir = dir
+	if cfg.PrepareProviderKey() == nil {
+		t.Error("accepted an invalid key file")
+	}
+}
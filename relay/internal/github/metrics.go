@@ -0,0 +1,23 @@
+package github
+
+import (
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+var (
+	requestsTotal   = metrics.NewCounterVec("github_requests_total", "GitHub API calls, by operation.", "operation")
+	requestErrors   = metrics.NewCounterVec("github_request_errors_total", "GitHub API calls that failed, by operation.", "operation")
+	requestDuration = metrics.NewHistogramVec("github_request_duration_seconds", "GitHub API call latency, by operation.", metrics.DefaultBuckets, "operation")
+)
+
+// observe records a finished API call. Use with a named error result:
+// defer observe("operation", time.Now(), &err).
+func observe(operation string, start time.Time, err *error) {
+	requestsTotal.Inc(operation)
+	requestDuration.ObserveSince(start, operation)
+	if *err != nil {
+		requestErrors.Inc(operation)
+	}
+}
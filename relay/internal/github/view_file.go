@@ -6,12 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
-)
-
-const (
-	githubAPIBaseURL = "https://api.github.com"
+	"time"
 )
 
 type GitHubFile struct {
@@ -27,16 +23,35 @@ type GitHubItem struct {
 
 var ErrGitHubTokenNotSet = fmt.Errorf("GITHUB_TOKEN environment variable is not set. Please set it to a valid GitHub personal access token with repo scope")
 
-func getGitHubToken() (string, error) {
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
+type Config struct {
+	Token   string
+	BaseURL string
+}
+
+// Client reads repository contents through the GitHub REST API.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+func NewClient(config Config) *Client {
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{},
+	}
+}
+
+func (c *Client) getGitHubToken() (string, error) {
+	if c.config.Token == "" {
 		return "", ErrGitHubTokenNotSet
 	}
-	return token, nil
+	return c.config.Token, nil
 }
 
-func ViewFile(owner, repo, path, branch string) (string, error) {
-	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", githubAPIBaseURL, owner, repo, path)
+func (c *Client) ViewFile(owner, repo, path, branch string) (content string, err error) {
+	defer observe("view_file", time.Now(), &err)
+
+	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", c.config.BaseURL, owner, repo, path)
 	if branch != "" {
 		url += fmt.Sprintf("?ref=%s", branch)
 	}
@@ -46,15 +61,14 @@ func ViewFile(owner, repo, path, branch string) (string, error) {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
-	token, err := getGitHubToken()
+	token, err := c.getGitHubToken()
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %v", err)
 	}
@@ -87,8 +101,10 @@ func ViewFile(owner, repo, path, branch string) (string, error) {
 	return string(decodedContent), nil
 }
 
-func ViewFolder(owner, repo, path, branch string) (string, error) {
-	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", githubAPIBaseURL, owner, repo, path)
+func (c *Client) ViewFolder(owner, repo, path, branch string) (listing string, err error) {
+	defer observe("view_folder", time.Now(), &err)
+
+	url := fmt.Sprintf("%s/repos/%s/%s/contents/%s", c.config.BaseURL, owner, repo, path)
 	if branch != "" {
 		url += fmt.Sprintf("?ref=%s", branch)
 	}
@@ -98,15 +114,14 @@ func ViewFolder(owner, repo, path, branch string) (string, error) {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
-	token, err := getGitHubToken()
+	token, err := c.getGitHubToken()
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to send request: %v", err)
 	}
@@ -0,0 +1,41 @@
+package groq
+
+import (
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/openai"
+)
+
+const DefaultBaseURL = "https://api.groq.com/openai/v1"
+
+type Config struct {
+	APIKey             string
+	BaseURL            string
+	ChatModel          string
+	TranscriptionModel string
+	Temperature        float64
+	MaxTokens          int
+	Timeout            time.Duration
+	MaxRetries         int
+}
+
+// NewClient returns a client for the Groq API. Groq serves an
+// OpenAI-compatible API; transcriptions are requested in English, which the
+// distil-whisper models require.
+func NewClient(config Config) *openai.Client {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	return openai.NewClient(openai.Config{
+		Name:               "groq",
+		APIKey:             config.APIKey,
+		BaseURL:            config.BaseURL,
+		ChatModel:          config.ChatModel,
+		TranscriptionModel: config.TranscriptionModel,
+		Temperature:        config.Temperature,
+		MaxTokens:          config.MaxTokens,
+		Language:           "en",
+		Timeout:            config.Timeout,
+		MaxRetries:         config.MaxRetries,
+	})
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Fake is a deterministic LLM and Transcriber for tests and local
+// development. It never calls tools and needs no network access.
+type Fake struct{}
+
+// Chat echoes the last user message.
+func (Fake) Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	prompt := ""
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			prompt = messages[i].Content
+			break
+		}
+	}
+	return &Response{
+		Role:    "assistant",
+		Content: fmt.Sprintf("Fake response to: %s", prompt),
+	}, nil
+}
+
+// ChatStream delivers the Chat reply one word at a time.
+func (f Fake) ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(delta string)) (*Response, error) {
+	response, err := f.Chat(ctx, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(response.Content, " ") {
+		if word != "" {
+			onDelta(word)
+		}
+	}
+	return response, nil
+}
+
+// Transcribe describes the audio instead of transcribing it.
+func (Fake) Transcribe(ctx context.Context, audio []byte, format string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Fake transcription of %d bytes of %s audio", len(audio), format), nil
+}
@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors reported by backends, for use with errors.Is.
+var (
+	// ErrRateLimited means the backend asked us to slow down.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUnauthorized means the API key is missing, invalid or lacks access.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrServer means the backend failed on its side.
+	ErrServer = errors.New("server error")
+	// ErrContextLength means the request is too long for the model.
+	ErrContextLength = errors.New("context length exceeded")
+)
+
+// LLM generates chat completions, optionally letting the model call tools.
+// Implementations give up when ctx is done.
+type LLM interface {
+	Chat(ctx context.Context, messages []Message, tools []Tool) (*Response, error)
+}
+
+// Transcriber turns audio in the given format, such as "mp3", into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, format string) (string, error)
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Parameters  Parameters `json:"parameters"`
+}
+
+type Parameters struct {
+	Type       string              `json:"type"`
+	Properties map[string]Property `json:"properties"`
+	Required   []string            `json:"required"`
+}
+
+type Property struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Response is the model's reply: text, tool calls, or both.
+type Response struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// Streamer is implemented by LLMs that can deliver a completion while it is
+// generated. onDelta receives each piece of text as it arrives; the returned
+// response holds the complete text and tool calls.
+type Streamer interface {
+	ChatStream(ctx context.Context, messages []Message, tools []Tool, onDelta func(delta string)) (*Response, error)
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Logger writes leveled records carrying key/value fields, either as
+// human-readable text or as one JSON object per line. Loggers derived with
+// With share their parent's output.
+type Logger struct {
+	out    *output
+	fields []field
+}
+
+type output struct {
+	w     io.Writer
+	level Level
+	json  bool
+	mu    sync.Mutex
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+func New(w io.Writer, level Level, jsonFormat bool) *Logger {
+	return &Logger{out: &output{w: w, level: level, json: jsonFormat}}
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo, false)
+
+// Default returns the process-wide logger.
+func Default() *Logger {
+	return defaultLogger
+}
+
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+// With returns a logger that adds the given key/value pairs to every record.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+len(keyvals)/2)
+	copy(fields, l.fields)
+	return &Logger{out: l.out, fields: appendFields(fields, keyvals)}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := appendFields(append([]field(nil), l.fields...), keyvals)
+
+	var line []byte
+	if l.out.json {
+		line = formatJSON(level, msg, fields)
+	} else {
+		line = formatText(level, msg, fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(line)
+}
+
+func appendFields(fields []field, keyvals []interface{}) []field {
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields = append(fields, field{key, sanitize(key, value)})
+	}
+	return fields
+}
+
+func formatJSON(level Level, msg string, fields []field) []byte {
+	record := make(map[string]interface{}, len(fields)+3)
+	for _, f := range fields {
+		record[f.key] = f.value
+	}
+	record["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = msg
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "log_error": err.Error()})
+	}
+	return append(line, '\n')
+}
+
+func formatText(level Level, msg string, fields []field) []byte {
+	var sb strings.Builder
+	sb.WriteString(time.Now().Format("2006/01/02 15:04:05"))
+	sb.WriteString(" ")
+	sb.WriteString(strings.ToUpper(level.String()))
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+
+	keys := make([]string, 0, len(fields))
+	values := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if _, ok := values[f.key]; !ok {
+			keys = append(keys, f.key)
+		}
+		values[f.key] = f.value
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(values[key])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		sb.WriteString(" ")
+		sb.WriteString(key)
+		sb.WriteString("=")
+		sb.WriteString(value)
+	}
+	sb.WriteString("\n")
+	return []byte(sb.String())
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxValueLength caps string fields so payloads such as base64 audio never
+// end up in the logs in full.
+const MaxValueLength = 256
+
+var sensitiveKeys = []string{"sig", "signature", "token", "api_key", "apikey", "authorization", "secret", "password", "nsec"}
+
+// sanitize redacts fields whose key names a secret and truncates long
+// string values.
+func sanitize(key string, value interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if lower == sensitive || strings.HasSuffix(lower, "_"+sensitive) {
+			return "[REDACTED]"
+		}
+	}
+
+	switch v := value.(type) {
+	case error:
+		return Truncate(v.Error(), MaxValueLength)
+	case string:
+		return Truncate(v, MaxValueLength)
+	case fmt.Stringer:
+		return Truncate(v.String(), MaxValueLength)
+	default:
+		return value
+	}
+}
+
+// Truncate shortens s to at most max bytes, noting how much was cut. It cuts
+// on a rune boundary so the result stays valid UTF-8.
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", s[:cut], len(s)-cut)
+}
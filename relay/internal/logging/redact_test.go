@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"hello world", 5, "hello...(6 bytes truncated)"},
+		// "é" is two bytes; cutting after its first byte backs off before it
+		{"cafés", 4, "caf...(3 bytes truncated)"},
+		{"éé", 1, "...(4 bytes truncated)"},
+	}
+	for _, tt := range tests {
+		got := Truncate(tt.in, tt.max)
+		if got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateKeepsValidUTF8(t *testing.T) {
+	s := strings.Repeat("日本語", 200)
+	for max := 0; max < 12; max++ {
+		got := Truncate(s, max)
+		if !utf8.ValidString(got) {
+			t.Errorf("Truncate(_, %d) = %q is not valid UTF-8", max, got)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	long := strings.Repeat("a", MaxValueLength+10)
+	tests := []struct {
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"sig", "abcd", "[REDACTED]"},
+		{"API_KEY", "sk-123", "[REDACTED]"},
+		{"provider_secret", "hex", "[REDACTED]"},
+		{"secrets", "kept", "kept"},
+		{"signer", "kept", "kept"},
+		{"content", long, long[:MaxValueLength] + "...(10 bytes truncated)"},
+		{"error", errors.New(long), long[:MaxValueLength] + "...(10 bytes truncated)"},
+		{"count", 3, 3},
+	}
+	for _, tt := range tests {
+		got := sanitize(tt.key, tt.value)
+		if got != tt.want {
+			t.Errorf("sanitize(%q, _) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestJSONOutputIsSanitized(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(&buf, LevelInfo, true).With("token", "hunter2")
+	log.Info("Job done", "content", strings.Repeat("ü", MaxValueLength))
+
+	var record map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if record["token"] != "[REDACTED]" {
+		t.Errorf("token logged as %v", record["token"])
+	}
+	content, _ := record["content"].(string)
+	if !strings.HasSuffix(content, "...(256 bytes truncated)") || strings.ContainsRune(content, utf8.RuneError) {
+		t.Errorf("content logged as %q", content)
+	}
+}
@@ -0,0 +1,13 @@
+package metrics
+
+import (
+	"net/http"
+)
+
+// Handler serves the registered metrics for Prometheus to scrape.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteAll(w)
+	})
+}
@@ -0,0 +1,282 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets suit request latencies from milliseconds up to the minute
+// an LLM call can take.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registry   []collector
+	registryMu sync.Mutex
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry = append(registry, c)
+}
+
+// WriteAll writes every registered metric in the Prometheus text exposition
+// format.
+func WriteAll(w io.Writer) {
+	registryMu.Lock()
+	collectors := make([]collector, len(registry))
+	copy(collectors, registry)
+	registryMu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// vec holds one series per combination of label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*series
+	mu     sync.Mutex
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Histogram state
+	counts []uint64
+	sum    float64
+	total  uint64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	v := &vec{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		// Unlabelled metrics are exported as zero before their first update
+		v.get(nil)
+	}
+	return v
+}
+
+func (v *vec) get(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// value returns the value of a series without creating it.
+func (v *vec) value(values []string, read func(s *series) float64) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if s, ok := v.series[strings.Join(values, "\xff")]; ok {
+		return read(s)
+	}
+	return 0
+}
+
+func (v *vec) sortedSeries() []*series {
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, ",") < strings.Join(all[j].labelValues, ",")
+	})
+	return all
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+func (v *vec) labelString(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", v.labels[i], value))
+	}
+	pairs = append(pairs, extra...)
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing value per label combination.
+type CounterVec struct {
+	v *vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+
+	c.v.get(labelValues).value += delta
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value of a series, mainly for tests.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	return c.v.value(labelValues, func(s *series) float64 { return s.value })
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+
+	c.v.writeHeader(w)
+	for _, s := range c.v.sortedSeries() {
+		fmt.Fprintf(w, "%s%s %s\n", c.v.name, c.v.labelString(s.labelValues), formatFloat(s.value))
+	}
+}
+
+// GaugeVec is a value that can go up and down per label combination.
+type GaugeVec struct {
+	v *vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newVec(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+
+	g.v.get(labelValues).value += delta
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+
+	g.v.get(labelValues).value = value
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value returns the current value of a series, mainly for tests.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	return g.v.value(labelValues, func(s *series) float64 { return s.value })
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+
+	g.v.writeHeader(w)
+	for _, s := range g.v.sortedSeries() {
+		fmt.Fprintf(w, "%s%s %s\n", g.v.name, g.v.labelString(s.labelValues), formatFloat(s.value))
+	}
+}
+
+// HistogramVec tracks the distribution of observed values, typically
+// latencies in seconds, per label combination.
+type HistogramVec struct {
+	v       *vec
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{newVec(name, help, "histogram", labels), buckets}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+
+	s := h.v.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.total++
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns how many values a series has observed, mainly for tests.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	return uint64(h.v.value(labelValues, func(s *series) float64 { return float64(s.total) }))
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+
+	h.v.writeHeader(w)
+	for _, s := range h.v.sortedSeries() {
+		for i, bound := range h.buckets {
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			le := fmt.Sprintf("le=%q", formatFloat(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, h.v.labelString(s.labelValues, le), count)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.v.name, h.v.labelString(s.labelValues, `le="+Inf"`), s.total)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.v.name, h.v.labelString(s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.v.name, h.v.labelString(s.labelValues), s.total)
+	}
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", value)
+}
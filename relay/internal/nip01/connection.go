@@ -0,0 +1,71 @@
+package nip01
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+)
+
+var nextConnectionID uint64
+
+// closePolicyViolation is sent when a client is disconnected for falling
+// behind on its subscriptions.
+const closePolicyViolation = websocket.ClosePolicyViolation
+
+// Connection wraps a client websocket so that the reader, subscription and
+// job goroutines can write to it concurrently.
+type Connection struct {
+	ID  uint64
+	ws  *websocket.Conn
+	log *logging.Logger
+	// drops counts events this connection's subscriptions lost to the slow
+	// consumer policy.
+	drops    uint64
+	slowOnce sync.Once
+	mu       sync.Mutex
+}
+
+func newConnection(ws *websocket.Conn) *Connection {
+	id := atomic.AddUint64(&nextConnectionID, 1)
+	return &Connection{
+		ID:  id,
+		ws:  ws,
+		log: logging.Default().With("conn_id", id, "remote", ws.RemoteAddr().String()),
+	}
+}
+
+// Logger returns a logger tagged with the connection ID, so job handlers
+// can correlate their output with the client that submitted the job.
+func (c *Connection) Logger() *logging.Logger {
+	return c.log
+}
+
+func (c *Connection) countDrop() {
+	atomic.AddUint64(&c.drops, 1)
+}
+
+// Dropped returns how many events this connection's subscriptions have lost.
+func (c *Connection) Dropped() uint64 {
+	return atomic.LoadUint64(&c.drops)
+}
+
+func (c *Connection) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ws.WriteJSON(v)
+}
+
+// CloseWithReason sends a websocket close frame before closing the socket.
+func (c *Connection) CloseWithReason(code int, reason string) error {
+	c.mu.Lock()
+	_ = c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+	c.mu.Unlock()
+	return c.ws.Close()
+}
+
+func (c *Connection) Close() error {
+	return c.ws.Close()
+}
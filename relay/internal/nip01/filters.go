@@ -0,0 +1,101 @@
+package nip01
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// parseSubscriptionRequest extracts the subscription ID and filters shared by
+// REQ and COUNT messages.
+func parseSubscriptionRequest(data []json.RawMessage, maxFilters int) (string, []*nostr.Filter, error) {
+	if len(data) < 2 {
+		return "", nil, fmt.Errorf("expected a subscription ID and at least one filter")
+	}
+	if len(data)-1 > maxFilters {
+		return "", nil, fmt.Errorf("at most %d filters are allowed", maxFilters)
+	}
+
+	subscriptionID, err := parseSubscriptionID(data[0])
+	if err != nil {
+		return "", nil, err
+	}
+
+	filters := make([]*nostr.Filter, 0, len(data)-1)
+	for _, filterData := range data[1:] {
+		filter, err := parseFilter(filterData)
+		if err != nil {
+			return "", nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return subscriptionID, filters, nil
+}
+
+// parseFilter decodes a NIP-01 filter. Known fields must have the right
+// type; unknown fields are ignored.
+func parseFilter(data json.RawMessage) (*nostr.Filter, error) {
+	if !isObject(data) {
+		return nil, fmt.Errorf("filter is not an object")
+	}
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("malformed filter: %v", err)
+	}
+
+	filter := &nostr.Filter{}
+	for key, value := range fields {
+		var target interface{}
+		switch key {
+		case "ids":
+			target = &filter.IDs
+		case "authors":
+			target = &filter.Authors
+		case "kinds":
+			target = &filter.Kinds
+		case "since":
+			target = &filter.Since
+		case "until":
+			target = &filter.Until
+		case "limit":
+			target = &filter.Limit
+		case "search":
+			target = &filter.Search
+		default:
+			if len(key) != 2 || key[0] != '#' {
+				continue
+			}
+			var values []string
+			err = json.Unmarshal(value, &values)
+			if err != nil {
+				return nil, fmt.Errorf("filter %s must be a list of strings", key)
+			}
+			if filter.Tags == nil {
+				filter.Tags = make(map[string][]string)
+			}
+			filter.Tags[key[1:]] = values
+			continue
+		}
+		err = json.Unmarshal(value, target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %v", key, err)
+		}
+	}
+
+	for _, id := range filter.IDs {
+		if !isHex(id, 64) {
+			return nil, fmt.Errorf("filter ids must be 64 lowercase hex characters")
+		}
+	}
+	for _, author := range filter.Authors {
+		if !isHex(author, 64) {
+			return nil, fmt.Errorf("filter authors must be 64 lowercase hex characters")
+		}
+	}
+	if filter.Limit < 0 {
+		return nil, fmt.Errorf("filter limit must not be negative")
+	}
+	return filter, nil
+}
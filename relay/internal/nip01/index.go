@@ -0,0 +1,154 @@
+package nip01
+
+import (
+	"sort"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// filterRef is one filter of one subscription.
+type filterRef struct {
+	sub    *Subscription
+	filter *nostr.Filter
+}
+
+type refSet map[*filterRef]struct{}
+
+// subscriptionIndex is an inverted index over subscription filters. Every
+// condition in a filter must hold for it to match, so each filter is filed
+// under a single field, the most selective one it constrains: an event can
+// only match filters filed under its own ID, author, kind or tag values,
+// plus the filters that constrain none of those.
+type subscriptionIndex struct {
+	byID      map[string]refSet
+	byAuthor  map[string]refSet
+	byTag     map[string]map[string]refSet
+	byKind    map[int]refSet
+	unindexed refSet
+	refs      map[*Subscription][]*filterRef
+}
+
+func newSubscriptionIndex() *subscriptionIndex {
+	return &subscriptionIndex{
+		byID:      make(map[string]refSet),
+		byAuthor:  make(map[string]refSet),
+		byTag:     make(map[string]map[string]refSet),
+		byKind:    make(map[int]refSet),
+		unindexed: make(refSet),
+		refs:      make(map[*Subscription][]*filterRef),
+	}
+}
+
+func (idx *subscriptionIndex) add(sub *Subscription) {
+	for _, filter := range sub.Filters {
+		ref := &filterRef{sub: sub, filter: filter}
+		idx.refs[sub] = append(idx.refs[sub], ref)
+		idx.file(ref, true)
+	}
+}
+
+func (idx *subscriptionIndex) remove(sub *Subscription) {
+	for _, ref := range idx.refs[sub] {
+		idx.file(ref, false)
+	}
+	delete(idx.refs, sub)
+}
+
+// file adds ref to, or removes it from, the buckets for its chosen field.
+func (idx *subscriptionIndex) file(ref *filterRef, add bool) {
+	filter := ref.filter
+	switch {
+	case len(filter.IDs) > 0:
+		for _, id := range filter.IDs {
+			updateString(idx.byID, id, ref, add)
+		}
+	case len(filter.Authors) > 0:
+		for _, author := range filter.Authors {
+			updateString(idx.byAuthor, author, ref, add)
+		}
+	case len(filter.Tags) > 0:
+		name := firstTagName(filter)
+		values, ok := idx.byTag[name]
+		if !ok {
+			values = make(map[string]refSet)
+			idx.byTag[name] = values
+		}
+		for _, value := range filter.Tags[name] {
+			updateString(values, value, ref, add)
+		}
+		if len(values) == 0 {
+			delete(idx.byTag, name)
+		}
+	case len(filter.Kinds) > 0:
+		for _, kind := range filter.Kinds {
+			set := idx.byKind[kind]
+			if add && set == nil {
+				set = make(refSet)
+				idx.byKind[kind] = set
+			}
+			toggle(set, ref, add)
+			if len(set) == 0 {
+				delete(idx.byKind, kind)
+			}
+		}
+	default:
+		toggle(idx.unindexed, ref, add)
+	}
+}
+
+// candidates returns the filters that could match the event. Callers still
+// have to run Match on each.
+func (idx *subscriptionIndex) candidates(event *nostr.Event, visit func(*filterRef)) {
+	for ref := range idx.byID[event.ID] {
+		visit(ref)
+	}
+	for ref := range idx.byAuthor[event.PubKey] {
+		visit(ref)
+	}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if values, ok := idx.byTag[tag[0]]; ok {
+			for ref := range values[tag[1]] {
+				visit(ref)
+			}
+		}
+	}
+	for ref := range idx.byKind[event.Kind] {
+		visit(ref)
+	}
+	for ref := range idx.unindexed {
+		visit(ref)
+	}
+}
+
+func updateString(sets map[string]refSet, key string, ref *filterRef, add bool) {
+	set := sets[key]
+	if add && set == nil {
+		set = make(refSet)
+		sets[key] = set
+	}
+	toggle(set, ref, add)
+	if len(set) == 0 {
+		delete(sets, key)
+	}
+}
+
+func toggle(set refSet, ref *filterRef, add bool) {
+	if add {
+		set[ref] = struct{}{}
+	} else {
+		delete(set, ref)
+	}
+}
+
+// firstTagName picks a deterministic tag name so add and remove agree.
+func firstTagName(filter *nostr.Filter) string {
+	names := make([]string, 0, len(filter.Tags))
+	for name := range filter.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
@@ -0,0 +1,127 @@
+package nip01
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// testSubscriptions opens n subscriptions with a mix of the filters clients
+// send: by author, by p tag, by kind, by ID and unconstrained.
+func testSubscriptions(sm *SubscriptionManager, n int, rng *rand.Rand) {
+	conn := &Connection{}
+	for i := 0; i < n; i++ {
+		filter := &nostr.Filter{}
+		switch i % 20 {
+		case 0:
+			filter.IDs = []string{fmt.Sprintf("id%d", rng.Intn(1000))}
+		case 1:
+			// Unconstrained apart from a time range
+			filter.Since = 1
+		case 2, 3, 4, 5, 6, 7, 8, 9:
+			filter.Authors = []string{fmt.Sprintf("author%d", rng.Intn(1000))}
+			filter.Kinds = []int{1}
+		case 10, 11, 12, 13, 14, 15:
+			filter.Tags = map[string][]string{"p": {fmt.Sprintf("author%d", rng.Intn(1000))}}
+		default:
+			filter.Kinds = []int{rng.Intn(50)}
+		}
+		sm.AddSubscription(conn, fmt.Sprintf("sub%d", i), []*nostr.Filter{filter})
+	}
+}
+
+func testEvent(rng *rand.Rand) *nostr.Event {
+	return &nostr.Event{
+		ID:        fmt.Sprintf("id%d", rng.Intn(1000)),
+		PubKey:    fmt.Sprintf("author%d", rng.Intn(1000)),
+		CreatedAt: 100,
+		Kind:      rng.Intn(50),
+		Tags:      [][]string{{"p", fmt.Sprintf("author%d", rng.Intn(1000))}},
+	}
+}
+
+// matchLinear checks every filter of every subscription, which is what
+// BroadcastEvent did before the index.
+func matchLinear(sm *SubscriptionManager, event *nostr.Event, visit func(*Subscription)) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for _, sub := range sm.subscriptions {
+		for _, filter := range sub.Filters {
+			if filter.Match(event) {
+				visit(sub)
+				break
+			}
+		}
+	}
+}
+
+func matchIndexed(sm *SubscriptionManager, event *nostr.Event, visit func(*Subscription)) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	matched := make(map[*Subscription]bool)
+	sm.index.candidates(event, func(ref *filterRef) {
+		if !matched[ref.sub] && ref.filter.Match(event) {
+			matched[ref.sub] = true
+			visit(ref.sub)
+		}
+	})
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sm := NewSubscriptionManager(1, DropOldest, 1)
+	testSubscriptions(sm, 2000, rng)
+	// Removed subscriptions must not linger in the index
+	conn := &Connection{}
+	for i := 0; i < 100; i++ {
+		sm.AddSubscription(conn, "gone", []*nostr.Filter{{Kinds: []int{i % 50}}})
+		sm.RemoveSubscription(conn, "gone")
+	}
+
+	for i := 0; i < 500; i++ {
+		event := testEvent(rng)
+		linear := make(map[*Subscription]bool)
+		matchLinear(sm, event, func(sub *Subscription) { linear[sub] = true })
+		indexed := make(map[*Subscription]bool)
+		matchIndexed(sm, event, func(sub *Subscription) { indexed[sub] = true })
+
+		if len(indexed) != len(linear) {
+			t.Fatalf("event %d: index matched %d subscriptions, linear scan %d", i, len(indexed), len(linear))
+		}
+		for sub := range linear {
+			if !indexed[sub] {
+				t.Fatalf("event %d: index missed subscription %s", i, sub.ID)
+			}
+		}
+	}
+}
+
+// BenchmarkBroadcast compares delivering events to 10k subscriptions through
+// the index with checking every subscription.
+func BenchmarkBroadcast(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	sm := NewSubscriptionManager(1, DropOldest, 1)
+	testSubscriptions(sm, 10000, rng)
+	events := make([]*nostr.Event, 1000)
+	for i := range events {
+		events[i] = testEvent(rng)
+	}
+
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sm.BroadcastEvent(events[i%len(events)])
+		}
+	})
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			event := events[i%len(events)]
+			matchLinear(sm, event, func(sub *Subscription) {
+				sub.deliver(event, sm.policy, sm.overflowSize)
+			})
+		}
+	})
+}
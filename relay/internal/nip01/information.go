@@ -0,0 +1,32 @@
+package nip01
+
+import (
+	"github.com/openagentsinc/v3/relay/internal/nip11"
+)
+
+var supportedNIPs = []int{1, 9, 11, 13, 40, 45, 50, 90}
+
+func (r *Relay) information() *nip11.RelayInformation {
+	info := &nip11.RelayInformation{
+		Name:          "OpenAgents Relay",
+		Description:   "Nostr relay serving OpenAgents NIP-90 data vending machines",
+		Software:      "https://github.com/openagentsinc/v3",
+		SupportedNIPs: supportedNIPs,
+		Limitation: &nip11.Limitation{
+			MaxMessageLength: r.limits.MaxMessageLength,
+			MaxFilters:       r.limits.MaxFilters,
+			MaxSubidLength:   MaxSubscriptionIDLength,
+		},
+	}
+	for _, service := range r.services.Services() {
+		info.Services = append(info.Services, nip11.ServiceInfo{
+			Kind:             service.Kind,
+			ResultKind:       service.ResultKind,
+			Name:             service.Name,
+			Description:      service.Description,
+			MinPowDifficulty: service.MinDifficulty,
+			PubKey:           r.providerPubKey,
+		})
+	}
+	return info
+}
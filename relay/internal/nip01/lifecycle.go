@@ -0,0 +1,121 @@
+package nip01
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+// jobsFileName is the journal of unfinished NIP-90 jobs, relative to the
+// data directory.
+const jobsFileName = "jobs.json"
+
+// Start serves the relay until the listener fails.
+func (r *Relay) Start(addr string) error {
+	return r.Run(context.Background(), addr)
+}
+
+// Run serves the relay on addr until ctx is cancelled, then shuts down
+// gracefully within the configured shutdown timeout.
+func (r *Relay) Run(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", r.HandleWebSocket)
+	mux.Handle("/metrics", metrics.Handler())
+	r.server = &http.Server{Addr: addr, Handler: mux}
+
+	go r.reaper.Run(expirationReapInterval, r.done)
+	r.resumeJobs()
+	if r.provider != nil {
+		r.provider.Start()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- r.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.shutdownTimeout)
+	defer cancel()
+	return r.Shutdown(shutdownCtx)
+}
+
+// Shutdown stops accepting connections and jobs, tells subscribers their
+// subscriptions are closed, waits for queued jobs until ctx is done, leaving
+// whatever is unfinished in the journal, and closes the store. Calls after the first
+// return immediately.
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.shuttingDown {
+		r.mu.Unlock()
+		return nil
+	}
+	r.shuttingDown = true
+	r.mu.Unlock()
+
+	log := logging.Default()
+	log.Info("Shutting down relay")
+
+	if r.server != nil {
+		err := r.server.Shutdown(ctx)
+		if err != nil {
+			log.Error("Error stopping HTTP server", "error", err)
+		}
+	}
+
+	if r.provider != nil {
+		r.provider.Close()
+	}
+	r.jobs.Close()
+
+	for _, sub := range r.subscriptionManager.RemoveAll() {
+		err := sub.conn.WriteJSON(common.CreateClosedMessage(sub.ID, "error: relay is shutting down"))
+		if err != nil {
+			sub.conn.log.Warn("Error writing CLOSED", "sub_id", sub.ID, "error", err)
+		}
+	}
+
+	err := r.jobs.Wait(ctx)
+	if err != nil {
+		log.Warn("Timed out waiting for in-flight jobs", "error", err)
+	}
+
+	unfinished := r.jobs.Unfinished()
+	if len(unfinished) > 0 {
+		log.Info("Leaving unfinished jobs to resume on the next start", "count", len(unfinished))
+	}
+
+	// Give results of the jobs that did finish a chance to reach the
+	// relays their customers asked for
+	err = r.outbox.Close(ctx)
+	if err != nil {
+		log.Warn("Timed out publishing job output to other relays", "error", err)
+	}
+
+	r.mu.Lock()
+	for conn := range r.connections {
+		conn.CloseWithReason(websocket.CloseGoingAway, "relay is shutting down")
+	}
+	r.mu.Unlock()
+
+	close(r.done)
+
+	err = r.store.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close store: %v", err)
+	}
+	return nil
+}
@@ -1,72 +1,223 @@
 package nip01
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"unicode/utf8"
 
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
-type MessageType int
+// MaxSubscriptionIDLength is the longest subscription ID a client may use.
+const MaxSubscriptionIDLength = 64
 
-const (
-	EventMessage MessageType = iota
-	ReqMessage
-	CloseMessage
-)
+// Limits bounds what ParseMessage accepts.
+type Limits struct {
+	MaxMessageLength int
+	MaxFilters       int
+}
 
-type Message struct {
-	Type MessageType
-	Data interface{}
+// Envelope is a parsed client message: one of EventEnvelope, ReqEnvelope,
+// CountEnvelope, CloseEnvelope or AuthEnvelope.
+type Envelope interface {
+	Label() string
 }
 
-func ParseMessage(data []byte) (*Message, error) {
-	var rawMessage []json.RawMessage
-	err := json.Unmarshal(data, &rawMessage)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse message: %v", err)
+type EventEnvelope struct {
+	Event *nostr.Event
+}
+
+type ReqEnvelope struct {
+	SubscriptionID string
+	Filters        []*nostr.Filter
+}
+
+type CountEnvelope struct {
+	SubscriptionID string
+	Filters        []*nostr.Filter
+}
+
+type CloseEnvelope struct {
+	SubscriptionID string
+}
+
+// AuthEnvelope is a NIP-42 authentication event.
+type AuthEnvelope struct {
+	Event *nostr.Event
+}
+
+func (*EventEnvelope) Label() string { return "EVENT" }
+func (*ReqEnvelope) Label() string   { return "REQ" }
+func (*CountEnvelope) Label() string { return "COUNT" }
+func (*CloseEnvelope) Label() string { return "CLOSE" }
+func (*AuthEnvelope) Label() string  { return "AUTH" }
+
+// ParseMessage decodes and validates a client message. Errors are phrased
+// for a NOTICE back to the client.
+func ParseMessage(data []byte, limits Limits) (Envelope, error) {
+	if len(data) > limits.MaxMessageLength {
+		return nil, fmt.Errorf("invalid: message is longer than %d bytes", limits.MaxMessageLength)
 	}
 
-	if len(rawMessage) < 2 {
-		return nil, fmt.Errorf("invalid message format")
+	var raw []json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid: message is not a JSON array: %v", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("invalid: empty message")
 	}
 
-	var messageType string
-	err = json.Unmarshal(rawMessage[0], &messageType)
+	var label string
+	err = json.Unmarshal(raw[0], &label)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse message type: %v", err)
+		return nil, fmt.Errorf("invalid: message type is not a string")
 	}
 
-	switch messageType {
+	switch label {
 	case "EVENT":
-		var event nostr.Event
-		err = json.Unmarshal(rawMessage[1], &event)
+		if len(raw) != 2 {
+			return nil, fmt.Errorf("invalid: EVENT takes exactly one event")
+		}
+		event, err := parseEvent(raw[1])
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse event: %v", err)
+			return nil, err
 		}
-		return &Message{Type: EventMessage, Data: &event}, nil
+		return &EventEnvelope{Event: event}, nil
 	case "REQ":
-		var reqData []interface{}
-		err = json.Unmarshal(data, &reqData)
+		id, filters, err := parseSubscriptionRequest(raw[1:], limits.MaxFilters)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse REQ message: %v", err)
+			return nil, fmt.Errorf("invalid REQ: %v", err)
 		}
-		return &Message{Type: ReqMessage, Data: reqData[1:]}, nil
+		return &ReqEnvelope{SubscriptionID: id, Filters: filters}, nil
+	case "COUNT":
+		id, filters, err := parseSubscriptionRequest(raw[1:], limits.MaxFilters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid COUNT: %v", err)
+		}
+		return &CountEnvelope{SubscriptionID: id, Filters: filters}, nil
 	case "CLOSE":
-		var closeData []interface{}
-		err = json.Unmarshal(data, &closeData)
+		if len(raw) != 2 {
+			return nil, fmt.Errorf("invalid: CLOSE takes exactly one subscription ID")
+		}
+		id, err := parseSubscriptionID(raw[1])
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse CLOSE message: %v", err)
+			return nil, fmt.Errorf("invalid CLOSE: %v", err)
 		}
-		if len(closeData) < 2 {
-			return nil, fmt.Errorf("invalid CLOSE message format")
+		return &CloseEnvelope{SubscriptionID: id}, nil
+	case "AUTH":
+		if len(raw) != 2 {
+			return nil, fmt.Errorf("invalid: AUTH takes exactly one event")
 		}
-		subscriptionID, ok := closeData[1].(string)
-		if !ok {
-			return nil, fmt.Errorf("invalid subscription ID in CLOSE message")
+		event, err := parseEvent(raw[1])
+		if err != nil {
+			return nil, err
 		}
-		return &Message{Type: CloseMessage, Data: subscriptionID}, nil
+		return &AuthEnvelope{Event: event}, nil
 	default:
-		return nil, fmt.Errorf("unknown message type: %s", messageType)
+		return nil, fmt.Errorf("invalid: unknown message type %q", label)
+	}
+}
+
+// parseEvent decodes an event and checks its fields are present and well
+// formed. id, pubkey and sig must be lowercase hex of the right length;
+// whether they verify is left to the caller.
+func parseEvent(data json.RawMessage) (*nostr.Event, error) {
+	var fields struct {
+		ID        *string          `json:"id"`
+		PubKey    *string          `json:"pubkey"`
+		CreatedAt *nostr.Timestamp `json:"created_at"`
+		Kind      *int             `json:"kind"`
+		Tags      *[][]string      `json:"tags"`
+		Content   *string          `json:"content"`
+		Sig       *string          `json:"sig"`
+	}
+	if !isObject(data) {
+		return nil, fmt.Errorf("invalid: event is not an object")
+	}
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid: malformed event: %v", err)
 	}
-}
\ No newline at end of file
+
+	switch {
+	case fields.CreatedAt == nil:
+		return nil, fmt.Errorf("invalid: event has no created_at")
+	case fields.Kind == nil:
+		return nil, fmt.Errorf("invalid: event has no kind")
+	case fields.Tags == nil:
+		return nil, fmt.Errorf("invalid: event has no tags")
+	case fields.Content == nil:
+		return nil, fmt.Errorf("invalid: event has no content")
+	}
+	if *fields.Kind < 0 || *fields.Kind > 65535 {
+		return nil, fmt.Errorf("invalid: kind %d is out of range", *fields.Kind)
+	}
+
+	event := &nostr.Event{
+		CreatedAt: *fields.CreatedAt,
+		Kind:      *fields.Kind,
+		Tags:      *fields.Tags,
+		Content:   *fields.Content,
+	}
+	if event.Tags == nil {
+		event.Tags = [][]string{}
+	}
+	for _, tag := range event.Tags {
+		if len(tag) == 0 {
+			return nil, fmt.Errorf("invalid: event has an empty tag")
+		}
+	}
+
+	hexFields := []struct {
+		name   string
+		value  *string
+		length int
+		target *string
+	}{
+		{"id", fields.ID, 64, &event.ID},
+		{"pubkey", fields.PubKey, 64, &event.PubKey},
+		{"sig", fields.Sig, 128, &event.Sig},
+	}
+	for _, field := range hexFields {
+		if field.value == nil || *field.value == "" {
+			return nil, fmt.Errorf("invalid: event has no %s", field.name)
+		}
+		if !isHex(*field.value, field.length) {
+			return nil, fmt.Errorf("invalid: %s must be %d lowercase hex characters", field.name, field.length)
+		}
+		*field.target = *field.value
+	}
+	return event, nil
+}
+
+func parseSubscriptionID(data json.RawMessage) (string, error) {
+	var id string
+	err := json.Unmarshal(data, &id)
+	if err != nil {
+		return "", fmt.Errorf("subscription ID is not a string")
+	}
+	if id == "" || utf8.RuneCountInString(id) > MaxSubscriptionIDLength {
+		return "", fmt.Errorf("subscription ID must be 1 to %d characters", MaxSubscriptionIDLength)
+	}
+	return id, nil
+}
+
+func isObject(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
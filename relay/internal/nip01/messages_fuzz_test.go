@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package nip01
+
+import (
+	"testing"
+)
+
+// FuzzParseMessage checks that no client message makes ParseMessage panic
+// and that whatever it accepts is well formed. The seed corpus lives in
+// testdata/fuzz/FuzzParseMessage.
+func FuzzParseMessage(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		envelope, err := ParseMessage(data, testLimits)
+		if err != nil {
+			return
+		}
+
+		switch env := envelope.(type) {
+		case *EventEnvelope:
+			checkEvent(t, env.Event.ID, env.Event.PubKey, env.Event.Sig, env.Event.Kind)
+		case *AuthEnvelope:
+			checkEvent(t, env.Event.ID, env.Event.PubKey, env.Event.Sig, env.Event.Kind)
+		case *ReqEnvelope:
+			checkSubscription(t, env.SubscriptionID, len(env.Filters))
+		case *CountEnvelope:
+			checkSubscription(t, env.SubscriptionID, len(env.Filters))
+		case *CloseEnvelope:
+			checkSubscription(t, env.SubscriptionID, 1)
+		}
+	})
+}
+
+func checkEvent(t *testing.T, id, pubKey, sig string, kind int) {
+	if !isHex(id, 64) || !isHex(pubKey, 64) || !isHex(sig, 128) {
+		t.Errorf("accepted an event with malformed id %q, pubkey %q or sig %q", id, pubKey, sig)
+	}
+	if kind < 0 || kind > 65535 {
+		t.Errorf("accepted kind %d", kind)
+	}
+}
+
+func checkSubscription(t *testing.T, id string, filters int) {
+	if id == "" || len([]rune(id)) > MaxSubscriptionIDLength {
+		t.Errorf("accepted subscription ID %q", id)
+	}
+	if filters < 1 || filters > testLimits.MaxFilters {
+		t.Errorf("accepted %d filters", filters)
+	}
+}
@@ -0,0 +1,74 @@
+package nip01
+
+import (
+	"strings"
+	"testing"
+)
+
+var testLimits = Limits{MaxMessageLength: 1 << 16, MaxFilters: 2}
+
+const (
+	testID     = "4376c65d2f232afbe9b882a35baa4f6fe8667c4e684749af565f981833ed6a65"
+	testPubKey = "6e468422dfb74a5738702a8823b9b28168abab8655faacb6853cd0ee15deee93"
+	testSig    = "908a15e46fb4d8675bab026fc230a0e3542bfade63da02d542fb78b2a8513fcd0092619a2c8c1221e581946e0191f2af505dfdf8657a414dbca329186f009262"
+)
+
+func TestParseMessage(t *testing.T) {
+	event := `{"id":"` + testID + `","pubkey":"` + testPubKey + `","created_at":1673347337,"kind":1,"tags":[],"content":"hi","sig":"` + testSig + `"}`
+	tests := []struct {
+		message string
+		label   string
+		err     string
+	}{
+		{`["EVENT",` + event + `]`, "EVENT", ""},
+		{`["AUTH",` + event + `]`, "AUTH", ""},
+		{`["REQ","sub",{"kinds":[1],"#e":["x"]}]`, "REQ", ""},
+		{`["COUNT","sub",{}]`, "COUNT", ""},
+		{`["CLOSE","sub"]`, "CLOSE", ""},
+
+		{`{}`, "", "not a JSON array"},
+		{`[]`, "", "empty message"},
+		{`[1]`, "", "message type is not a string"},
+		{`["PING"]`, "", "unknown message type"},
+		{`["EVENT"]`, "", "exactly one event"},
+		{`["EVENT",[]]`, "", "event is not an object"},
+		{`["EVENT",{"created_at":1,"kind":1,"tags":[],"content":""}]`, "", "event has no id"},
+		{`["EVENT",` + strings.Replace(event, `"sig":"`+testSig+`"`, `"sig":""`, 1) + `]`, "", "event has no sig"},
+		{`["EVENT",` + strings.Replace(event, testPubKey, strings.ToUpper(testPubKey), 1) + `]`, "", "pubkey must be 64 lowercase hex"},
+		{`["EVENT",` + strings.Replace(event, "1673347337", "1673347337.5", 1) + `]`, "", "malformed event"},
+		{`["EVENT",` + strings.Replace(event, `"kind":1`, `"kind":70000`, 1) + `]`, "", "out of range"},
+		{`["EVENT",` + strings.Replace(event, `"tags":[]`, `"tags":[[]]`, 1) + `]`, "", "empty tag"},
+		{`["REQ","sub"]`, "", "at least one filter"},
+		{`["REQ","sub",{},{},{}]`, "", "at most 2 filters"},
+		{`["REQ","",{}]`, "", "subscription ID must be 1 to 64"},
+		{`["REQ","` + strings.Repeat("s", 65) + `",{}]`, "", "subscription ID must be 1 to 64"},
+		{`["REQ","sub",{"ids":["abc"]}]`, "", "ids must be 64 lowercase hex"},
+		{`["REQ","sub",{"limit":-1}]`, "", "limit must not be negative"},
+		{`["REQ","sub",{"kinds":"1"}]`, "", "invalid filter kinds"},
+		{`["CLOSE"]`, "", "exactly one subscription ID"},
+	}
+	for _, test := range tests {
+		envelope, err := ParseMessage([]byte(test.message), testLimits)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.message, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.message, err)
+			continue
+		}
+		if envelope.Label() != test.label {
+			t.Errorf("%s: got %s, want %s", test.message, envelope.Label(), test.label)
+		}
+	}
+}
+
+func TestParseMessageLength(t *testing.T) {
+	message := `["CLOSE","` + strings.Repeat("s", 100) + `"]`
+	_, err := ParseMessage([]byte(message), Limits{MaxMessageLength: 50, MaxFilters: 1})
+	if err == nil || !strings.Contains(err.Error(), "longer than 50 bytes") {
+		t.Errorf("got %v", err)
+	}
+}
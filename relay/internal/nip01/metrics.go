@@ -0,0 +1,36 @@
+package nip01
+
+import (
+	"strconv"
+
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+var (
+	connectionsOpen     = metrics.NewGaugeVec("relay_connections_open", "Websocket connections currently open.")
+	connectionsTotal    = metrics.NewCounterVec("relay_connections_total", "Websocket connections accepted.")
+	subscriptionsActive = metrics.NewGaugeVec("relay_subscriptions_active", "Subscriptions currently open.")
+	eventsReceived      = metrics.NewCounterVec("relay_events_received_total", "EVENT messages received, by kind.", "kind")
+	eventsRejected      = metrics.NewCounterVec("relay_events_rejected_total", "Events refused with OK false, by reason prefix.", "reason")
+	eventsBroadcast     = metrics.NewCounterVec("relay_events_broadcast_total", "Live events written to subscriptions.")
+	eventsDropped       = metrics.NewCounterVec("relay_events_dropped_total", "Events dropped because a subscription's buffer was full.")
+	messagesInvalid     = metrics.NewCounterVec("relay_messages_invalid_total", "Client messages rejected by validation.")
+)
+
+// metricKinds are the common event kinds counted under their own label.
+var metricKinds = map[int]bool{0: true, 1: true, 3: true, 5: true, 7: true, 7000: true}
+
+// kindLabel returns the metric label for an event kind: the kind itself for
+// common kinds and our job request and result kinds, and "other" for the
+// rest, so clients cannot create a series per kind.
+func (r *Relay) kindLabel(kind int) string {
+	if metricKinds[kind] {
+		return strconv.Itoa(kind)
+	}
+	for _, service := range r.services.Services() {
+		if kind == service.Kind || kind == service.ResultKind {
+			return strconv.Itoa(kind)
+		}
+	}
+	return "other"
+}
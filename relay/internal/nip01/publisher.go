@@ -0,0 +1,94 @@
+package nip01
+
+import (
+	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// publisher delivers job output by ingesting it like any other event, so it
+// is stored and reaches every matching subscription, including other devices
+// of the customer and clients that reconnect later. When the submitting
+// connection is known the event is also written to it directly, since
+// clients such as the mobile app read results without subscribing, unless
+// one of its subscriptions already delivered it. Jobs resumed after a
+// restart have no connection.
+type publisher struct {
+	relay *Relay
+	conn  *Connection
+}
+
+func (p *publisher) Logger() *logging.Logger {
+	if p.conn != nil {
+		return p.conn.log
+	}
+	return logging.Default()
+}
+
+func (p *publisher) WriteJSON(v interface{}) error {
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) < 2 || msg[0] != "EVENT" {
+		return p.write(v)
+	}
+	event, ok := msg[len(msg)-1].(*nostr.Event)
+	if !ok {
+		return p.write(v)
+	}
+
+	err := p.relay.ingestEvent(event)
+	if err != nil {
+		p.Logger().Warn("Error ingesting job output", "event_id", event.ID, "kind", event.Kind, "error", err)
+		return p.write(v)
+	}
+	if p.conn != nil && p.relay.subscriptionManager.Subscribed(p.conn, event) {
+		return nil
+	}
+	return p.write(v)
+}
+
+// replay writes an event the relay already has, such as the result of a
+// resubmitted job request, to the submitting connection the way WriteJSON
+// delivers job output to it: through its matching subscriptions, or else
+// directly as ["EVENT", <event>]. The event is not ingested again.
+func (p *publisher) replay(event *nostr.Event) error {
+	if p.conn == nil || p.relay.subscriptionManager.DeliverTo(p.conn, event) {
+		return nil
+	}
+	return p.write(common.CreateEventMessage(event))
+}
+
+// WriteDirect writes v to the submitting connection only.
+func (p *publisher) WriteDirect(v interface{}) error {
+	return p.write(v)
+}
+
+func (p *publisher) write(v interface{}) error {
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.WriteJSON(v)
+}
+
+// resumeJobs re-enqueues the jobs that were queued or processing when the
+// relay last stopped and tells their customers the work is continuing.
+func (r *Relay) resumeJobs() {
+	log := logging.Default()
+	jobs, err := r.jobs.Load()
+	if err != nil {
+		log.Error("Error loading unfinished jobs", "error", err)
+		return
+	}
+
+	p := &publisher{relay: r}
+	for _, job := range jobs {
+		if job.Request == nil {
+			continue
+		}
+		err = r.jobs.Resume(p, job)
+		if err != nil {
+			log.Error("Error resuming job", "job_id", job.Request.ID, "error", err)
+			continue
+		}
+		log.Info("Resumed job", "job_id", job.Request.ID, "kind", job.Request.Kind, "status", job.Status)
+	}
+}
@@ -1,45 +1,180 @@
 package nip01
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
+	"github.com/openagentsinc/v3/relay/internal/nip09"
+	"github.com/openagentsinc/v3/relay/internal/nip11"
+	"github.com/openagentsinc/v3/relay/internal/nip40"
 	"github.com/openagentsinc/v3/relay/internal/nip90"
 	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/internal/config"
+	"github.com/openagentsinc/v3/relay/internal/github"
+	"github.com/openagentsinc/v3/relay/internal/groq"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/internal/llm"
+	"github.com/openagentsinc/v3/relay/internal/lru"
+	"github.com/openagentsinc/v3/relay/internal/openai"
+	"github.com/openagentsinc/v3/relay/internal/pool"
+	"github.com/openagentsinc/v3/relay/internal/store"
 )
 
 type Relay struct {
 	upgrader            websocket.Upgrader
 	subscriptionManager *SubscriptionManager
+	store               store.Store
+	reaper              *nip40.Reaper
+	services            *nip90.Registry
+	seen                *lru.Cache
+	jobs                *nip90.Queue
+	outbox              *pool.Pool
+	providerPubKey      string
+	provider            *nip90.Provider
+	shutdownTimeout     time.Duration
+	limits              Limits
+	server              *http.Server
+	connections         map[*Connection]struct{}
+	shuttingDown        bool
+	done                chan struct{}
 	mu                  sync.Mutex
 }
 
-func NewRelay() *Relay {
+const (
+	// expirationReapInterval is how often expired events are purged from the store.
+	expirationReapInterval = time.Minute
+	// seenCacheSize bounds the in-memory set of recently accepted event IDs
+	// checked before falling back to the store.
+	seenCacheSize = 10000
+)
+
+func NewRelay(cfg *config.Config) *Relay {
+	handlers := &nip90.Handlers{
+		LLM:         newBackend(cfg, 5838),
+		Transcriber: newBackend(cfg, 5252),
+		GitHub: github.NewClient(github.Config{
+			Token:   cfg.GitHub.Token,
+			BaseURL: cfg.GitHub.BaseURL,
+		}),
+		MaxIterations: cfg.Agent.MaxIterations,
+		MaxWords:      cfg.Agent.MaxWords,
+	}
+	services := nip90.DefaultRegistry(handlers)
+	for kind, serviceConfig := range cfg.Services {
+		if service, ok := services.Lookup(kind); ok {
+			service.MinDifficulty = serviceConfig.MinPowDifficulty
+		}
+	}
+
+	outbox := pool.New(pool.Options{
+		MaxAttempts: cfg.Provider.PublishAttempts,
+		Allow:       cfg.Provider.PublishAllow,
+		Deny:        cfg.Provider.PublishDeny,
+		MaxRelays:   cfg.Provider.MaxPublishRelays,
+	})
+	jobs := nip90.NewQueue(services, cfg.Relay.JobWorkers, cfg.Relay.JobQueueSize, cfg.DataPath(jobsFileName))
+	jobs.SetProvider(cfg.Provider.SecretKey, outbox)
+	providerPubKey, _ := nostr.GetPublicKey(cfg.Provider.SecretKey)
+	var provider *nip90.Provider
+	if len(cfg.Provider.Relays) > 0 {
+		provider = nip90.NewProvider(services, jobs, cfg.Provider.Relays, providerPubKey, cfg.Provider.MentionsOnly)
+	}
+
+	eventStore := store.NewMemoryStore()
 	return &Relay{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for now
 			},
 		},
-		subscriptionManager: NewSubscriptionManager(),
+		subscriptionManager: NewSubscriptionManager(cfg.Relay.SubscriptionBuffer, SlowConsumerPolicy(cfg.Relay.SlowConsumerPolicy), cfg.Relay.OverflowBuffer),
+		store:               eventStore,
+		reaper:              nip40.NewReaper(eventStore),
+		services:            services,
+		seen:                lru.New(seenCacheSize),
+		jobs:                jobs,
+		outbox:              outbox,
+		providerPubKey:      providerPubKey,
+		provider:            provider,
+		shutdownTimeout:     time.Duration(cfg.Relay.ShutdownTimeout) * time.Second,
+		limits: Limits{
+			MaxMessageLength: cfg.Relay.MaxMessageLength,
+			MaxFilters:       cfg.Relay.MaxFilters,
+		},
+		connections: make(map[*Connection]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// backend is a model provider; every backend can both chat and transcribe.
+type backend interface {
+	llm.LLM
+	llm.Transcriber
+}
+
+// newBackend builds the model backend configured for the service of kind.
+func newBackend(cfg *config.Config, kind int) backend {
+	switch cfg.Backend(kind) {
+	case config.BackendOpenAI:
+		return openai.NewClient(openai.Config{
+			APIKey:             cfg.OpenAI.APIKey,
+			BaseURL:            cfg.OpenAI.BaseURL,
+			ChatModel:          cfg.OpenAI.ChatModel,
+			TranscriptionModel: cfg.OpenAI.TranscriptionModel,
+			Temperature:        cfg.OpenAI.Temperature,
+			MaxTokens:          cfg.OpenAI.MaxTokens,
+			Timeout:            time.Duration(cfg.OpenAI.Timeout) * time.Second,
+			MaxRetries:         cfg.OpenAI.MaxRetries,
+		})
+	case config.BackendFake:
+		return llm.Fake{}
+	default:
+		return groq.NewClient(groq.Config{
+			APIKey:             cfg.Groq.APIKey,
+			BaseURL:            cfg.Groq.BaseURL,
+			ChatModel:          cfg.Groq.ChatModel,
+			TranscriptionModel: cfg.Groq.TranscriptionModel,
+			Temperature:        cfg.Groq.Temperature,
+			MaxTokens:          cfg.Groq.MaxTokens,
+			Timeout:            time.Duration(cfg.Groq.Timeout) * time.Second,
+			MaxRetries:         cfg.Groq.MaxRetries,
+		})
 	}
 }
 
 func (r *Relay) HandleWebSocket(w http.ResponseWriter, req *http.Request) {
-	conn, err := r.upgrader.Upgrade(w, req, nil)
+	if nip11.IsInformationRequest(req) {
+		err := nip11.WriteInformation(w, r.information())
+		if err != nil {
+			logging.Default().Error("Error writing relay information", "error", err)
+		}
+		return
+	}
+
+	ws, err := r.upgrader.Upgrade(w, req, nil)
 	if err != nil {
-		log.Println("Error upgrading to WebSocket:", err)
+		logging.Default().Warn("Error upgrading to WebSocket", "error", err, "remote", req.RemoteAddr)
+		return
+	}
+	ws.SetReadLimit(int64(r.limits.MaxMessageLength))
+	conn := newConnection(ws)
+	if !r.addConnection(conn) {
+		conn.CloseWithReason(websocket.CloseGoingAway, "relay is shutting down")
 		return
 	}
-	defer conn.Close()
+	defer r.removeConnection(conn)
+	conn.log.Info("Connection opened")
 
 	for {
-		_, message, err := conn.ReadMessage()
+		_, message, err := ws.ReadMessage()
 		if err != nil {
-			log.Println("Error reading message:", err)
+			conn.log.Info("Connection closed", "reason", err, "dropped", conn.Dropped())
 			break
 		}
 
@@ -47,106 +182,337 @@ func (r *Relay) HandleWebSocket(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (r *Relay) handleMessage(conn *websocket.Conn, message []byte) {
-	msg, err := ParseMessage(message)
+func (r *Relay) handleMessage(conn *Connection, message []byte) {
+	envelope, err := ParseMessage(message, r.limits)
 	if err != nil {
-		log.Println("Error parsing message:", err)
+		conn.log.Warn("Error parsing message", "error", err)
+		messagesInvalid.Inc()
+		err = conn.WriteJSON(common.CreateNoticeMessage(err.Error()))
+		if err != nil {
+			conn.log.Warn("Error writing NOTICE", "error", err)
+		}
 		return
 	}
 
-	switch msg.Type {
-	case EventMessage:
-		event, ok := msg.Data.(*nostr.Event)
-		if !ok {
-			log.Println("Error: EventMessage data is not of type *nostr.Event")
+	switch env := envelope.(type) {
+	case *EventEnvelope:
+		r.handleEventMessage(conn, env.Event)
+	case *ReqEnvelope:
+		r.handleReqMessage(conn, env)
+	case *CountEnvelope:
+		r.handleCountMessage(conn, env)
+	case *CloseEnvelope:
+		r.handleCloseMessage(conn, env.SubscriptionID)
+	case *AuthEnvelope:
+		r.sendOK(conn, env.Event.ID, false, "restricted: authentication is not supported")
+	default:
+		conn.log.Warn("Unknown message type", "type", envelope.Label())
+	}
+}
+
+func (r *Relay) handleEventMessage(conn *Connection, event *nostr.Event) {
+	log := conn.log.With("event_id", event.ID)
+	log.Debug("Handling event", "kind", event.Kind)
+	eventsReceived.Inc(r.kindLabel(event.Kind))
+
+	if !event.CheckID() {
+		r.sendOK(conn, event.ID, false, "invalid: event id does not match its content")
+		return
+	}
+	if !event.CheckSignature() {
+		r.sendOK(conn, event.ID, false, "invalid: event signature verification failed")
+		return
+	}
+
+	service, isJob := r.services.Lookup(event.Kind)
+	if r.isDuplicate(event) {
+		r.handleDuplicateEvent(conn, event, isJob)
+		return
+	}
+
+	if isJob {
+		err := nostr.CheckProofOfWork(event, service.MinDifficulty)
+		if err != nil {
+			r.sendOK(conn, event.ID, false, "pow: "+err.Error())
 			return
 		}
-		r.handleEventMessage(conn, event)
-	case ReqMessage:
-		r.handleReqMessage(conn, msg)
-	case CloseMessage:
-		subscriptionID, ok := msg.Data.(string)
-		if !ok {
-			log.Println("Error: CloseMessage data is not of type string")
+	}
+
+	err := r.ingestEvent(event)
+	if err != nil {
+		log.Info("Rejected event", "kind", event.Kind, "reason", err)
+		r.sendOK(conn, event.ID, false, err.Error())
+		return
+	}
+
+	if isJob {
+		err = r.jobs.Enqueue(&publisher{relay: r, conn: conn}, event)
+		if errors.Is(err, nip90.ErrDuplicateJob) {
+			// Another connection submitted the same request at the same
+			// time and its job was queued first
+			r.handleDuplicateEvent(conn, event, isJob)
+			return
+		}
+		if err != nil {
+			log.Error("Error queuing job", "job_id", event.ID, "error", err)
+			// Forget the request so a retry is not taken for a duplicate
+			r.seen.Remove(event.ID)
+			deleteErr := r.store.DeleteEvent(event.ID)
+			if deleteErr != nil {
+				log.Error("Error removing refused job request", "job_id", event.ID, "error", deleteErr)
+			}
+			r.sendOK(conn, event.ID, false, "error: "+err.Error())
 			return
 		}
-		r.handleCloseMessage(conn, subscriptionID)
-	default:
-		log.Println("Unknown message type:", msg.Type)
 	}
+	r.sendOK(conn, event.ID, true, "")
 }
 
-func (r *Relay) handleEventMessage(conn *websocket.Conn, event *nostr.Event) {
-	log.Printf("Handling event with kind: %d", event.Kind)
+// ingestEvent stores the event (unless it is ephemeral) and fans it out to
+// matching subscriptions. The returned error is suitable for an OK message.
+func (r *Relay) ingestEvent(event *nostr.Event) error {
+	if nip40.IsExpired(event, time.Now()) {
+		return fmt.Errorf("invalid: event has expired")
+	}
 
-	switch {
-	case event.Kind == 5252 || event.Kind == 5838:
-		nip90.HandleNIP90Event(conn, event)
-	default:
-		// Handle other event types or broadcast to subscribers
-		r.subscriptionManager.BroadcastEvent(event)
+	if nip09.IsDeleted(r.store, event) {
+		return fmt.Errorf("blocked: event was deleted by its author")
+	}
+
+	if event.Kind == nip09.KindDeletion {
+		err := nip09.HandleDeletionRequest(r.store, event)
+		if err != nil {
+			return fmt.Errorf("error: %v", err)
+		}
+		// Forget deleted IDs so resubmissions are refused rather than
+		// acknowledged as duplicates, and drop jobs for deleted requests
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "e" {
+				r.seen.Remove(tag[1])
+				r.jobs.Forget(tag[1], event.PubKey)
+			}
+		}
+	}
+
+	if !event.IsEphemeral() {
+		err := r.store.SaveEvent(event)
+		if err != nil {
+			logging.Default().Error("Error storing event", "event_id", event.ID, "error", err)
+			return fmt.Errorf("error: could not store event")
+		}
+		r.reaper.Track(event)
 	}
+
+	r.seen.Add(event.ID, struct{}{})
+	r.subscriptionManager.BroadcastEvent(event)
+	return nil
 }
 
-func (r *Relay) handleReqMessage(conn *websocket.Conn, msg *Message) {
-	log.Printf("Handling REQ message: %+v", msg)
+// isDuplicate reports whether an event with the same ID was already accepted.
+func (r *Relay) isDuplicate(event *nostr.Event) bool {
+	if r.seen.Contains(event.ID) {
+		return true
+	}
+
+	stored, err := r.store.QueryEvents(&nostr.Filter{IDs: []string{event.ID}, Limit: 1})
+	if err != nil || len(stored) == 0 {
+		return false
+	}
+	r.seen.Add(event.ID, struct{}{})
+	return true
+}
 
-	reqData, ok := msg.Data.([]interface{})
-	if !ok {
-		log.Println("Error: REQ message data is not of type []interface{}")
+// handleDuplicateEvent acknowledges a resubmitted event and, for job
+// requests, replays the result instead of running the service again. The
+// event's ID and signature were verified, and the ID commits to the pubkey,
+// so only the original request's author can be the resubmitter.
+func (r *Relay) handleDuplicateEvent(conn *Connection, event *nostr.Event, isJob bool) {
+	if !isJob {
+		r.sendOK(conn, event.ID, true, "duplicate: already have this event")
 		return
 	}
 
-	if len(reqData) < 2 {
-		log.Println("Invalid REQ message format")
+	result, ok := r.jobResult(event)
+	if ok {
+		r.sendOK(conn, event.ID, true, "duplicate: replaying job result")
+		err := (&publisher{relay: r, conn: conn}).replay(result)
+		if err != nil {
+			conn.log.Warn("Error writing replayed job result", "job_id", event.ID, "error", err)
+		}
+		return
+	}
+	if r.jobs.Pending(event.ID) {
+		r.sendOK(conn, event.ID, true, "duplicate: job is already being processed")
 		return
 	}
 
-	subscriptionID, ok := reqData[0].(string)
-	if !ok {
-		log.Println("Invalid subscription ID in REQ message")
+	// The job's result is gone, or it never finished, such as when the relay
+	// restarted without its journal; run it again
+	err := r.jobs.Enqueue(&publisher{relay: r, conn: conn}, event)
+	if errors.Is(err, nip90.ErrDuplicateJob) {
+		r.sendOK(conn, event.ID, true, "duplicate: job is already being processed")
+		return
+	}
+	if err != nil {
+		conn.log.Error("Error queuing job", "job_id", event.ID, "error", err)
+		r.sendOK(conn, event.ID, false, "error: "+err.Error())
 		return
 	}
+	r.sendOK(conn, event.ID, true, "duplicate: running job again")
+}
+
+// jobResult finds the result we published for a job request, first among
+// recent results and then in the store. Results are only returned to the
+// request's author.
+func (r *Relay) jobResult(request *nostr.Event) (*nostr.Event, bool) {
+	result, ok := r.jobs.Result(request.ID)
+	if !ok {
+		filter := &nostr.Filter{
+			Authors: []string{r.providerPubKey},
+			Tags:    map[string][]string{"e": {request.ID}},
+			Limit:   1,
+		}
+		for _, service := range r.services.Services() {
+			filter.Kinds = append(filter.Kinds, service.ResultKind)
+		}
+		stored, err := r.store.QueryEvents(filter)
+		if err != nil || len(stored) == 0 {
+			return nil, false
+		}
+		result = stored[0]
+	}
 
-	filters := make([]*nostr.Filter, 0)
-	for _, filterData := range reqData[1:] {
-		filterMap, ok := filterData.(map[string]interface{})
-		if !ok {
-			log.Println("Invalid filter format in REQ message")
+	for _, tag := range result.Tags {
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] == request.PubKey {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Relay) sendOK(conn *Connection, eventID string, accepted bool, message string) {
+	if !accepted {
+		eventsRejected.Inc(okReason(message))
+	}
+	err := conn.WriteJSON(common.CreateOKMessage(eventID, accepted, message))
+	if err != nil {
+		conn.log.Warn("Error writing OK", "event_id", eventID, "error", err)
+	}
+}
+
+// okReason extracts the machine-readable prefix of an OK message, such as
+// "blocked" or "pow".
+func okReason(message string) string {
+	if i := strings.Index(message, ":"); i > 0 {
+		return message[:i]
+	}
+	return "unknown"
+}
+
+func (r *Relay) handleReqMessage(conn *Connection, req *ReqEnvelope) {
+	subscriptionID, filters := req.SubscriptionID, req.Filters
+	conn.log.Debug("Opening subscription", "sub_id", subscriptionID, "filters", len(filters))
+	stored := r.queryStoredEvents(filters)
+	sub := r.subscriptionManager.AddSubscription(conn, subscriptionID, filters)
+	go r.handleSubscription(sub, stored)
+}
+
+func (r *Relay) queryStoredEvents(filters []*nostr.Filter) []*nostr.Event {
+	now := time.Now()
+	seen := make(map[string]bool)
+	events := make([]*nostr.Event, 0)
+	for _, filter := range filters {
+		matches, err := r.store.QueryEvents(filter)
+		if err != nil {
+			logging.Default().Error("Error querying stored events", "error", err)
 			continue
 		}
-		filter := &nostr.Filter{}
-		// Parse filter data and populate the filter object
-		// This is a simplified version, you may need to add more fields
-		if ids, ok := filterMap["ids"].([]interface{}); ok {
-			filter.IDs = make([]string, len(ids))
-			for i, id := range ids {
-				filter.IDs[i], _ = id.(string)
+		for _, event := range matches {
+			if seen[event.ID] || nip40.IsExpired(event, now) {
+				continue
 			}
+			seen[event.ID] = true
+			events = append(events, event)
 		}
-		filters = append(filters, filter)
 	}
+	return events
+}
 
-	sub := r.subscriptionManager.AddSubscription(subscriptionID, filters)
-	go r.handleSubscription(conn, sub)
+func (r *Relay) handleCountMessage(conn *Connection, req *CountEnvelope) {
+	count := r.CountEvents(req.Filters)
+	err := conn.WriteJSON(common.CreateCountMessage(req.SubscriptionID, count))
+	if err != nil {
+		conn.log.Warn("Error writing COUNT", "sub_id", req.SubscriptionID, "error", err)
+	}
 }
 
-func (r *Relay) handleCloseMessage(conn *websocket.Conn, subscriptionID string) {
-	r.subscriptionManager.RemoveSubscription(subscriptionID)
+// CountEvents returns how many stored events match any of the filters, using
+// the same matching rules as a REQ. As NIP-45 asks, a filter's limit does not
+// cap the count.
+func (r *Relay) CountEvents(filters []*nostr.Filter) int {
+	unlimited := make([]*nostr.Filter, len(filters))
+	for i, filter := range filters {
+		f := *filter
+		f.Limit = 0
+		unlimited[i] = &f
+	}
+	return len(r.queryStoredEvents(unlimited))
 }
 
-func (r *Relay) handleSubscription(conn *websocket.Conn, sub *Subscription) {
+func (r *Relay) handleCloseMessage(conn *Connection, subscriptionID string) {
+	r.subscriptionManager.RemoveSubscription(conn, subscriptionID)
+}
+
+func (r *Relay) handleSubscription(sub *Subscription, stored []*nostr.Event) {
+	conn := sub.conn
+	log := conn.log.With("sub_id", sub.ID)
+	for _, event := range stored {
+		err := conn.WriteJSON(common.CreateSubscriptionEventMessage(sub.ID, event))
+		if err != nil {
+			log.Warn("Error writing stored event", "event_id", event.ID, "error", err)
+			return
+		}
+	}
+	err := conn.WriteJSON(common.CreateEOSEMessage(sub.ID))
+	if err != nil {
+		log.Warn("Error writing EOSE", "error", err)
+		return
+	}
+
 	for event := range sub.Events {
-		msg := common.CreateEventMessage(event)
+		msg := common.CreateSubscriptionEventMessage(sub.ID, event)
 		err := conn.WriteJSON(msg)
 		if err != nil {
-			log.Println("Error writing event to WebSocket:", err)
+			log.Warn("Error writing event", "event_id", event.ID, "error", err)
 			break
 		}
+		// Counted once written, since buffered events may still be dropped
+		eventsBroadcast.Inc()
+		sub.refill()
 	}
 }
 
-func (r *Relay) Start(addr string) error {
-	http.HandleFunc("/", r.HandleWebSocket)
-	return http.ListenAndServe(addr, nil)
-}
\ No newline at end of file
+func (r *Relay) addConnection(conn *Connection) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.shuttingDown {
+		return false
+	}
+	r.connections[conn] = struct{}{}
+	connectionsOpen.Inc()
+	connectionsTotal.Inc()
+	return true
+}
+
+func (r *Relay) removeConnection(conn *Connection) {
+	r.mu.Lock()
+	if _, ok := r.connections[conn]; ok {
+		delete(r.connections, conn)
+		connectionsOpen.Dec()
+	}
+	r.mu.Unlock()
+
+	r.subscriptionManager.RemoveConnection(conn)
+	conn.Close()
+}
@@ -0,0 +1,540 @@
+package nip01
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/internal/config"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// newTestRelay serves a relay with fake model backends on an in-process
+// server and returns its websocket URL.
+func newTestRelay(t *testing.T, configure ...func(cfg *config.Config)) (*Relay, string) {
+	t.Helper()
+	secretKey, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Relay.DataDir = t.TempDir()
+	cfg.Provider.SecretKey = secretKey
+	cfg.Services = map[int]config.ServiceConfig{
+		5252: {Backend: config.BackendFake},
+		5838: {Backend: config.BackendFake},
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	relay := NewRelay(cfg)
+	server := httptest.NewServer(http.HandlerFunc(relay.HandleWebSocket))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = relay.Shutdown(ctx)
+		server.Close()
+	})
+	return relay, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// testConn is a raw websocket client that speaks just enough NIP-01 to
+// drive the relay from tests.
+type testConn struct {
+	t  *testing.T
+	ws *websocket.Conn
+}
+
+func dialTestRelay(t *testing.T, url string) *testConn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return &testConn{t: t, ws: ws}
+}
+
+func (c *testConn) send(msg ...interface{}) {
+	c.t.Helper()
+	err := c.ws.WriteJSON(msg)
+	if err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// read returns the next message, failing the test after a few seconds.
+func (c *testConn) read() []json.RawMessage {
+	c.t.Helper()
+	_ = c.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg []json.RawMessage
+	err := c.ws.ReadJSON(&msg)
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+// readUntil skips messages until one labelled label arrives.
+func (c *testConn) readUntil(label string) []json.RawMessage {
+	c.t.Helper()
+	for {
+		msg := c.read()
+		if len(msg) > 0 && decodeString(c.t, msg[0]) == label {
+			return msg
+		}
+	}
+}
+
+// publish sends event and returns the relay's OK verdict.
+func (c *testConn) publish(event *nostr.Event) (bool, string) {
+	c.t.Helper()
+	c.send("EVENT", event)
+	for {
+		msg := c.readUntil("OK")
+		if decodeString(c.t, msg[1]) != event.ID {
+			continue
+		}
+		var accepted bool
+		_ = json.Unmarshal(msg[2], &accepted)
+		return accepted, decodeString(c.t, msg[3])
+	}
+}
+
+func decodeString(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+	var s string
+	err := json.Unmarshal(raw, &s)
+	if err != nil {
+		t.Fatalf("expected a string, got %s", raw)
+	}
+	return s
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func publicKey(t *testing.T, secretKey string) string {
+	t.Helper()
+	pubKey, err := nostr.GetPublicKey(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pubKey
+}
+
+func signedEvent(t *testing.T, secretKey string, kind int, content string, tags ...[]string) *nostr.Event {
+	t.Helper()
+	if tags == nil {
+		tags = [][]string{}
+	}
+	event := &nostr.Event{CreatedAt: nostr.Now(), Kind: kind, Tags: tags, Content: content}
+	err := event.Sign(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestEventMustBeSigned(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+
+	conn.send("EVENT", map[string]interface{}{
+		"created_at": time.Now().Unix(),
+		"kind":       1,
+		"tags":       [][]string{},
+		"content":    "unsigned",
+	})
+	msg := conn.read()
+	if label := decodeString(t, msg[0]); label != "NOTICE" {
+		t.Fatalf("expected NOTICE for an unsigned event, got %s", label)
+	}
+	if notice := decodeString(t, msg[1]); notice != "invalid: event has no id" {
+		t.Errorf("unexpected notice %q", notice)
+	}
+}
+
+func TestEventIDAndSignatureAreVerified(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	key := newKey(t)
+
+	tampered := signedEvent(t, key, 1, "original")
+	tampered.Content = "tampered"
+	accepted, message := conn.publish(tampered)
+	if accepted || message != "invalid: event id does not match its content" {
+		t.Errorf("tampered content: got %v %q", accepted, message)
+	}
+
+	forged := signedEvent(t, key, 1, "forged")
+	forged.PubKey = publicKey(t, newKey(t))
+	forged.ID = forged.ComputeID()
+	accepted, message = conn.publish(forged)
+	if accepted || message != "invalid: event signature verification failed" {
+		t.Errorf("forged pubkey: got %v %q", accepted, message)
+	}
+
+	valid := signedEvent(t, key, 1, "hello")
+	accepted, message = conn.publish(valid)
+	if !accepted || message != "" {
+		t.Errorf("valid event: got %v %q", accepted, message)
+	}
+}
+
+func TestForgedDeletionIsRefused(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	victim := newKey(t)
+	note := signedEvent(t, victim, 1, "mine")
+	if accepted, message := conn.publish(note); !accepted {
+		t.Fatalf("note refused: %s", message)
+	}
+
+	// A deletion claiming to be from the victim but signed by someone else
+	attacker := newKey(t)
+	forged := signedEvent(t, attacker, 5, "", []string{"e", note.ID})
+	forged.PubKey = publicKey(t, victim)
+	forged.ID = forged.ComputeID()
+	accepted, message := conn.publish(forged)
+	if accepted || message != "invalid: event signature verification failed" {
+		t.Errorf("forged deletion: got %v %q", accepted, message)
+	}
+
+	// A genuine deletion by the attacker cannot touch the victim's event
+	deletion := signedEvent(t, attacker, 5, "", []string{"e", note.ID})
+	if accepted, message := conn.publish(deletion); !accepted {
+		t.Fatalf("attacker's own deletion refused: %s", message)
+	}
+
+	conn.send("REQ", "notes", map[string]interface{}{"ids": []string{note.ID}})
+	msg := conn.read()
+	if label := decodeString(t, msg[0]); label != "EVENT" {
+		t.Fatalf("victim's event is gone, got %s", label)
+	}
+	conn.readUntil("EOSE")
+}
+
+func TestEphemeralEventsAreBroadcastButNotStored(t *testing.T) {
+	_, url := newTestRelay(t)
+	subscriber := dialTestRelay(t, url)
+	subscriber.send("REQ", "live", map[string]interface{}{"kinds": []int{20001}})
+	subscriber.readUntil("EOSE")
+
+	publisher := dialTestRelay(t, url)
+	event := signedEvent(t, newKey(t), 20001, "typing")
+	if accepted, message := publisher.publish(event); !accepted {
+		t.Fatalf("ephemeral event refused: %s", message)
+	}
+
+	msg := subscriber.readUntil("EVENT")
+	var received nostr.Event
+	_ = json.Unmarshal(msg[2], &received)
+	if decodeString(t, msg[1]) != "live" || received.ID != event.ID {
+		t.Errorf("unexpected broadcast %s", msg)
+	}
+
+	publisher.send("REQ", "later", map[string]interface{}{"ids": []string{event.ID}})
+	if label := decodeString(t, publisher.read()[0]); label != "EOSE" {
+		t.Errorf("ephemeral event was stored, got %s", label)
+	}
+}
+
+// expiresIn returns an expiration tag d from now.
+func expiresIn(d time.Duration) []string {
+	return []string{"expiration", strconv.FormatInt(time.Now().Add(d).Unix(), 10)}
+}
+
+func TestExpiredEventIsRefused(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+
+	event := signedEvent(t, newKey(t), 1, "too late", expiresIn(-time.Minute))
+	accepted, message := conn.publish(event)
+	if accepted || message != "invalid: event has expired" {
+		t.Errorf("got %v %q", accepted, message)
+	}
+}
+
+func TestExpiredEventsAreHiddenAndReaped(t *testing.T) {
+	relay, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	key := newKey(t)
+	expiring := signedEvent(t, key, 1, "soon gone", expiresIn(time.Hour))
+	lasting := signedEvent(t, key, 1, "here to stay")
+	for _, event := range []*nostr.Event{expiring, lasting} {
+		if accepted, message := conn.publish(event); !accepted {
+			t.Fatalf("event refused: %s", message)
+		}
+	}
+	// Stored before its expiration passed, and not reaped yet
+	expired := signedEvent(t, key, 1, "already gone", expiresIn(-time.Minute))
+	_ = relay.store.SaveEvent(expired)
+
+	conn.send("REQ", "notes", map[string]interface{}{"authors": []string{expiring.PubKey}})
+	var got []string
+	for {
+		msg := conn.read()
+		if decodeString(t, msg[0]) == "EOSE" {
+			break
+		}
+		var event nostr.Event
+		_ = json.Unmarshal(msg[2], &event)
+		got = append(got, event.Content)
+	}
+	if len(got) != 2 || strings.Contains(strings.Join(got, ","), "already gone") {
+		t.Errorf("REQ returned %q", got)
+	}
+
+	if n := relay.reaper.Reap(time.Now()); n != 0 {
+		t.Errorf("reaped %d events before they expired", n)
+	}
+	if n := relay.reaper.Reap(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("reaped %d events, want 1", n)
+	}
+	stored, _ := relay.store.QueryEvents(&nostr.Filter{IDs: []string{expiring.ID, lasting.ID}})
+	if len(stored) != 1 || stored[0].ID != lasting.ID {
+		t.Errorf("store holds %d events after reaping, want only the lasting one", len(stored))
+	}
+}
+
+func TestCountIgnoresLimit(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	key := newKey(t)
+	for i := 0; i < 3; i++ {
+		if accepted, message := conn.publish(signedEvent(t, key, 1, strconv.Itoa(i))); !accepted {
+			t.Fatalf("event refused: %s", message)
+		}
+	}
+
+	conn.send("COUNT", "notes", map[string]interface{}{"authors": []string{publicKey(t, key)}, "limit": 2})
+	msg := conn.readUntil("COUNT")
+	var count struct {
+		Count int `json:"count"`
+	}
+	err := json.Unmarshal(msg[2], &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodeString(t, msg[1]) != "notes" || count.Count != 3 {
+		t.Errorf("got %s, want a count of 3 for notes", msg)
+	}
+}
+
+func audioRequest(t *testing.T, secretKey string, recording string) *nostr.Event {
+	t.Helper()
+	audio := base64.StdEncoding.EncodeToString([]byte(recording))
+	return signedEvent(t, secretKey, 5252, "", []string{"i", audio}, []string{"param", "format", "mp3"})
+}
+
+// readResult waits for the job result written directly to the connection.
+func (c *testConn) readResult(kind int) *nostr.Event {
+	c.t.Helper()
+	for {
+		msg := c.readUntil("EVENT")
+		var event nostr.Event
+		err := json.Unmarshal(msg[len(msg)-1], &event)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if event.Kind == kind {
+			return &event
+		}
+	}
+}
+
+func TestResubmittedJobReplaysResult(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	request := audioRequest(t, newKey(t), "audio")
+
+	if accepted, message := conn.publish(request); !accepted {
+		t.Fatalf("job refused: %s", message)
+	}
+	result := conn.readResult(6252)
+
+	accepted, message := conn.publish(request)
+	if !accepted || message != "duplicate: replaying job result" {
+		t.Fatalf("resubmission: got %v %q", accepted, message)
+	}
+	// Without a matching subscription the result is written directly
+	msg := conn.readUntil("EVENT")
+	var replayed nostr.Event
+	_ = json.Unmarshal(msg[len(msg)-1], &replayed)
+	if len(msg) != 2 || replayed.ID != result.ID {
+		t.Errorf("replayed %s, want %s written directly", msg, result.ID)
+	}
+}
+
+func TestReplayedResultUsesMatchingSubscription(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	conn.send("REQ", "results", map[string]interface{}{"kinds": []int{6252}})
+	conn.readUntil("EOSE")
+	request := audioRequest(t, newKey(t), "audio")
+	if accepted, message := conn.publish(request); !accepted {
+		t.Fatalf("job refused: %s", message)
+	}
+	result := conn.readResult(6252)
+
+	if accepted, message := conn.publish(request); !accepted {
+		t.Fatalf("resubmission refused: %s", message)
+	}
+	msg := conn.readUntil("EVENT")
+	var replayed nostr.Event
+	_ = json.Unmarshal(msg[len(msg)-1], &replayed)
+	if len(msg) != 3 || decodeString(t, msg[1]) != "results" || replayed.ID != result.ID {
+		t.Errorf("replayed %s, want %s on the subscription", msg, result.ID)
+	}
+}
+
+func TestJobResultFallsBackToStore(t *testing.T) {
+	providerKey := newKey(t)
+	relay, _ := newTestRelay(t, func(cfg *config.Config) {
+		cfg.Provider.SecretKey = providerKey
+	})
+	customer := newKey(t)
+	request := audioRequest(t, customer, "first")
+	result := signedEvent(t, providerKey, 6252, "text", []string{"e", request.ID}, []string{"p", request.PubKey})
+	_ = relay.store.SaveEvent(result)
+
+	found, ok := relay.jobResult(request)
+	if !ok || found.ID != result.ID {
+		t.Fatalf("stored result not found: %v", ok)
+	}
+
+	// A result someone else published for the request is not ours to replay
+	other := audioRequest(t, customer, "second")
+	forged := signedEvent(t, newKey(t), 6252, "text", []string{"e", other.ID}, []string{"p", other.PubKey})
+	_ = relay.store.SaveEvent(forged)
+	if _, ok := relay.jobResult(other); ok {
+		t.Error("replayed a result published by another key")
+	}
+
+	// Nor is a result addressed to someone other than the resubmitter
+	third := audioRequest(t, newKey(t), "third")
+	misaddressed := signedEvent(t, providerKey, 6252, "text", []string{"e", third.ID}, []string{"p", request.PubKey})
+	_ = relay.store.SaveEvent(misaddressed)
+	if _, ok := relay.jobResult(third); ok {
+		t.Error("replayed a result addressed to another customer")
+	}
+}
+
+func TestResubmittedJobWithoutResultRunsAgain(t *testing.T) {
+	relay, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	request := audioRequest(t, newKey(t), "audio")
+	// Accepted before a restart that lost the journal
+	_ = relay.store.SaveEvent(request)
+
+	accepted, message := conn.publish(request)
+	if !accepted || message != "duplicate: running job again" {
+		t.Fatalf("resubmission: got %v %q", accepted, message)
+	}
+	conn.readResult(6252)
+}
+
+func TestJobOutputReachesSubscriberOnce(t *testing.T) {
+	_, url := newTestRelay(t)
+	conn := dialTestRelay(t, url)
+	conn.send("REQ", "output", map[string]interface{}{"kinds": []int{6252, 7000}})
+	conn.readUntil("EOSE")
+
+	request := audioRequest(t, newKey(t), "audio")
+	if accepted, message := conn.publish(request); !accepted {
+		t.Fatalf("job refused: %s", message)
+	}
+
+	// Every output event arrives once, on the subscription
+	received := make(map[string]int)
+	for {
+		_ = conn.ws.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		var msg []json.RawMessage
+		if conn.ws.ReadJSON(&msg) != nil {
+			break
+		}
+		if decodeString(t, msg[0]) != "EVENT" {
+			continue
+		}
+		if len(msg) != 3 {
+			t.Errorf("output written directly although subscribed: %s", msg[1])
+			continue
+		}
+		var event nostr.Event
+		_ = json.Unmarshal(msg[2], &event)
+		received[event.ID]++
+	}
+	if len(received) == 0 {
+		t.Fatal("no job output received")
+	}
+	for id, n := range received {
+		if n != 1 {
+			t.Errorf("event %s received %d times", id, n)
+		}
+	}
+}
+
+func TestRefusedJobCanBeRetried(t *testing.T) {
+	_, url := newTestRelay(t, func(cfg *config.Config) {
+		// No workers and no buffer: every job is refused as the queue is full
+		cfg.Relay.JobWorkers = 0
+		cfg.Relay.JobQueueSize = 0
+	})
+	conn := dialTestRelay(t, url)
+	request := audioRequest(t, newKey(t), "audio")
+
+	for attempt := 0; attempt < 2; attempt++ {
+		accepted, message := conn.publish(request)
+		if accepted || message != "error: job queue is full" {
+			t.Fatalf("attempt %d: got %v %q", attempt, accepted, message)
+		}
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	relay, _ := newTestRelay(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := relay.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = relay.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("second shutdown: %v", err)
+	}
+}
+
+func TestKindLabel(t *testing.T) {
+	relay, _ := newTestRelay(t)
+	tests := map[int]string{
+		1:     "1",
+		5:     "5",
+		5252:  "5252",
+		6838:  "6838",
+		7000:  "7000",
+		42:    "other",
+		65535: "other",
+	}
+	for kind, want := range tests {
+		if got := relay.kindLabel(kind); got != want {
+			t.Errorf("kindLabel(%d) = %q, want %q", kind, got, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package nip01
+
+import (
+	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// SlowConsumerPolicy decides what happens when a subscription's buffer is
+// full because its client is not reading fast enough.
+type SlowConsumerPolicy string
+
+const (
+	// DropOldest discards the oldest buffered event to make room.
+	DropOldest SlowConsumerPolicy = "drop-oldest"
+	// Disconnect sends a NOTICE and closes the slow client's connection.
+	Disconnect SlowConsumerPolicy = "disconnect"
+	// Spill queues events in a per-subscription overflow buffer, dropping
+	// the oldest overflowed event once that is full too.
+	Spill SlowConsumerPolicy = "spill"
+)
+
+// deliver hands the event to the subscription according to policy. It never
+// blocks. Callers must hold the subscription manager's read lock.
+func (sub *Subscription) deliver(event *nostr.Event, policy SlowConsumerPolicy, overflowSize int) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	// Once events have spilled, later ones queue behind them to keep order
+	if len(sub.overflow) == 0 {
+		select {
+		case sub.Events <- event:
+			return
+		default:
+		}
+	}
+
+	switch policy {
+	case DropOldest:
+		select {
+		case <-sub.Events:
+			sub.dropped()
+		default:
+		}
+		select {
+		case sub.Events <- event:
+		default:
+			sub.dropped()
+		}
+	case Disconnect:
+		sub.dropped()
+		sub.conn.disconnectSlow(sub.ID)
+	case Spill:
+		if len(sub.overflow) >= overflowSize {
+			sub.overflow = sub.overflow[1:]
+			sub.dropped()
+		}
+		sub.overflow = append(sub.overflow, event)
+	}
+}
+
+// refill moves spilled events into the Events channel as space frees up.
+// It is called by the subscription's writer after each event it sends.
+func (sub *Subscription) refill() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	for !sub.closed && len(sub.overflow) > 0 {
+		select {
+		case sub.Events <- sub.overflow[0]:
+			sub.overflow[0] = nil
+			sub.overflow = sub.overflow[1:]
+		default:
+			return
+		}
+	}
+}
+
+func (sub *Subscription) dropped() {
+	eventsDropped.Inc()
+	sub.conn.countDrop()
+}
+
+// disconnectSlow tells the client why and closes its connection. Only the
+// first call has an effect.
+func (c *Connection) disconnectSlow(subscriptionID string) {
+	c.slowOnce.Do(func() {
+		c.log.Warn("Disconnecting slow consumer", "sub_id", subscriptionID, "dropped", c.Dropped())
+		go func() {
+			_ = c.WriteJSON(common.CreateNoticeMessage("error: disconnected because subscription " + subscriptionID + " could not keep up"))
+			_ = c.CloseWithReason(closePolicyViolation, "slow consumer")
+		}()
+	})
+}
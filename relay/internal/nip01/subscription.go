@@ -1,73 +1,192 @@
 package nip01
 
 import (
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
 	"sync"
 )
 
 type Subscription struct {
-	ID     string
+	ID      string
 	Filters []*nostr.Filter
 	Events  chan *nostr.Event
+	conn    *Connection
+	// overflow holds events spilled past a full Events channel under the
+	// Spill policy.
+	overflow []*nostr.Event
+	// closed is set once Events is closed. The writer refills Events from
+	// the overflow without the manager's lock, so it checks closed under mu
+	// before sending.
+	closed bool
+	mu     sync.Mutex
+}
+
+// closeEvents closes the Events channel, ending the subscription's writer.
+func (sub *Subscription) closeEvents() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		sub.overflow = nil
+		close(sub.Events)
+	}
+}
+
+// subscriptionKey scopes subscription IDs to their connection, since clients
+// pick IDs independently of each other.
+type subscriptionKey struct {
+	conn *Connection
+	id   string
 }
 
 type SubscriptionManager struct {
-	subscriptions map[string]*Subscription
+	subscriptions map[subscriptionKey]*Subscription
+	index         *subscriptionIndex
+	bufferSize    int
+	policy        SlowConsumerPolicy
+	overflowSize  int
 	mu            sync.RWMutex
 }
 
-func NewSubscriptionManager() *SubscriptionManager {
+func NewSubscriptionManager(bufferSize int, policy SlowConsumerPolicy, overflowSize int) *SubscriptionManager {
 	return &SubscriptionManager{
-		subscriptions: make(map[string]*Subscription),
+		subscriptions: make(map[subscriptionKey]*Subscription),
+		index:         newSubscriptionIndex(),
+		bufferSize:    bufferSize,
+		policy:        policy,
+		overflowSize:  overflowSize,
 	}
 }
 
-func (sm *SubscriptionManager) AddSubscription(id string, filters []*nostr.Filter) *Subscription {
+func (sm *SubscriptionManager) AddSubscription(conn *Connection, id string, filters []*nostr.Filter) *Subscription {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	key := subscriptionKey{conn, id}
+	// A REQ reusing an ID replaces the previous subscription
+	if existing, ok := sm.subscriptions[key]; ok {
+		sm.index.remove(existing)
+		existing.closeEvents()
+		subscriptionsActive.Dec()
+	}
+
 	sub := &Subscription{
-		ID:     id,
+		ID:      id,
 		Filters: filters,
-		Events:  make(chan *nostr.Event, 100), // Buffered channel to prevent blocking
+		Events:  make(chan *nostr.Event, sm.bufferSize), // Buffered channel to prevent blocking
+		conn:    conn,
 	}
-	sm.subscriptions[id] = sub
+	sm.subscriptions[key] = sub
+	sm.index.add(sub)
+	subscriptionsActive.Inc()
 	return sub
 }
 
-func (sm *SubscriptionManager) RemoveSubscription(id string) {
+func (sm *SubscriptionManager) RemoveSubscription(conn *Connection, id string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if sub, ok := sm.subscriptions[id]; ok {
-		close(sub.Events)
-		delete(sm.subscriptions, id)
+	key := subscriptionKey{conn, id}
+	if sub, ok := sm.subscriptions[key]; ok {
+		sm.index.remove(sub)
+		sub.closeEvents()
+		delete(sm.subscriptions, key)
+		subscriptionsActive.Dec()
+	}
+}
+
+// RemoveConnection drops every subscription belonging to conn.
+func (sm *SubscriptionManager) RemoveConnection(conn *Connection) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for key, sub := range sm.subscriptions {
+		if key.conn == conn {
+			sm.index.remove(sub)
+			sub.closeEvents()
+			delete(sm.subscriptions, key)
+			subscriptionsActive.Dec()
+		}
+	}
+}
+
+// RemoveAll drops every subscription and returns them, so the caller can
+// tell their clients.
+func (sm *SubscriptionManager) RemoveAll() []*Subscription {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	removed := make([]*Subscription, 0, len(sm.subscriptions))
+	for key, sub := range sm.subscriptions {
+		sub.closeEvents()
+		delete(sm.subscriptions, key)
+		subscriptionsActive.Dec()
+		removed = append(removed, sub)
 	}
+	sm.index = newSubscriptionIndex()
+	return removed
 }
 
-func (sm *SubscriptionManager) GetSubscription(id string) (*Subscription, bool) {
+func (sm *SubscriptionManager) GetSubscription(conn *Connection, id string) (*Subscription, bool) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	sub, ok := sm.subscriptions[id]
+	sub, ok := sm.subscriptions[subscriptionKey{conn, id}]
 	return sub, ok
 }
 
-func (sm *SubscriptionManager) BroadcastEvent(event *nostr.Event) {
+// Subscribed reports whether one of conn's subscriptions matches event.
+func (sm *SubscriptionManager) Subscribed(conn *Connection, event *nostr.Event) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	for key, sub := range sm.subscriptions {
+		if key.conn != conn {
+			continue
+		}
+		for _, filter := range sub.Filters {
+			if filter.Match(event) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeliverTo delivers event to conn's matching subscriptions only, and
+// reports whether there were any.
+func (sm *SubscriptionManager) DeliverTo(conn *Connection, event *nostr.Event) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	for _, sub := range sm.subscriptions {
+	delivered := false
+	for key, sub := range sm.subscriptions {
+		if key.conn != conn {
+			continue
+		}
 		for _, filter := range sub.Filters {
 			if filter.Match(event) {
-				select {
-				case sub.Events <- event:
-					// Event sent successfully
-				default:
-					// Channel is full, consider handling this case (e.g., logging, dropping events)
-				}
-				break // Move to the next subscription once we've matched and sent the event
+				sub.deliver(event, sm.policy, sm.overflowSize)
+				delivered = true
+				break
 			}
 		}
 	}
-}
\ No newline at end of file
+	return delivered
+}
+
+// BroadcastEvent delivers event to every subscription with a matching
+// filter. Only the filters the index offers as candidates are checked.
+func (sm *SubscriptionManager) BroadcastEvent(event *nostr.Event) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	delivered := make(map[*Subscription]bool)
+	sm.index.candidates(event, func(ref *filterRef) {
+		if delivered[ref.sub] || !ref.filter.Match(event) {
+			return
+		}
+		delivered[ref.sub] = true
+		ref.sub.deliver(event, sm.policy, sm.overflowSize)
+	})
+}
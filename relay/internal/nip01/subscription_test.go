@@ -0,0 +1,175 @@
+package nip01
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// connectionPair returns the relay's end of a websocket connection and the
+// client's end.
+func connectionPair(t *testing.T) (*Connection, *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *Connection, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- newConnection(ws)
+	}))
+	t.Cleanup(server.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return <-accepted, client
+}
+
+func readMessage(t *testing.T, client *websocket.Conn) []json.RawMessage {
+	t.Helper()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg []json.RawMessage
+	err := client.ReadJSON(&msg)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func TestSpilledEventsAreCountedOnceWritten(t *testing.T) {
+	conn, client := connectionPair(t)
+	sm := NewSubscriptionManager(1, Spill, 1)
+	sub := sm.AddSubscription(conn, "sub", []*nostr.Filter{{Kinds: []int{1}}})
+	broadcast, dropped := eventsBroadcast.Value(), eventsDropped.Value()
+
+	// One event fits the buffer and one the overflow; the third pushes the
+	// second out
+	for i := 0; i < 3; i++ {
+		sm.BroadcastEvent(&nostr.Event{ID: strconv.Itoa(i), Kind: 1})
+	}
+	if eventsBroadcast.Value() != broadcast || eventsDropped.Value() != dropped+1 {
+		t.Fatalf("before writing: %v broadcast, %v dropped", eventsBroadcast.Value()-broadcast, eventsDropped.Value()-dropped)
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		(&Relay{}).handleSubscription(sub, nil)
+	}()
+	readMessage(t, client) // EOSE
+	for _, want := range []string{"0", "2"} {
+		var event nostr.Event
+		_ = json.Unmarshal(readMessage(t, client)[2], &event)
+		if event.ID != want {
+			t.Errorf("got event %s, want %s", event.ID, want)
+		}
+	}
+	sm.RemoveSubscription(conn, "sub")
+	<-written
+
+	if eventsBroadcast.Value() != broadcast+2 || eventsDropped.Value() != dropped+1 {
+		t.Errorf("after writing: %v broadcast, %v dropped, want 2 and 1", eventsBroadcast.Value()-broadcast, eventsDropped.Value()-dropped)
+	}
+}
+
+// TestSpillRefillRacesWithClose closes spilling subscriptions in every way
+// a client can while their writer is still refilling from the overflow.
+// Run with -race.
+func TestSpillRefillRacesWithClose(t *testing.T) {
+	closers := map[string]func(sm *SubscriptionManager, conn *Connection){
+		"close": func(sm *SubscriptionManager, conn *Connection) {
+			sm.RemoveSubscription(conn, "sub")
+		},
+		"reused id": func(sm *SubscriptionManager, conn *Connection) {
+			sm.AddSubscription(conn, "sub", []*nostr.Filter{{Kinds: []int{2}}})
+		},
+		"disconnect": func(sm *SubscriptionManager, conn *Connection) {
+			sm.RemoveConnection(conn)
+		},
+		"shutdown": func(sm *SubscriptionManager, conn *Connection) {
+			sm.RemoveAll()
+		},
+	}
+	for name, closeSub := range closers {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				sm := NewSubscriptionManager(1, Spill, 100)
+				conn := &Connection{}
+				sub := sm.AddSubscription(conn, "sub", []*nostr.Filter{{Kinds: []int{1}}})
+				for j := 0; j < 50; j++ {
+					sm.BroadcastEvent(&nostr.Event{ID: strconv.Itoa(j), Kind: 1})
+				}
+
+				written := make(chan struct{})
+				go func() {
+					defer close(written)
+					for range sub.Events {
+						sub.refill()
+					}
+				}()
+				closeSub(sm, conn)
+				<-written
+			}
+		})
+	}
+}
+
+func TestDropOldestKeepsNewestEvents(t *testing.T) {
+	sm := NewSubscriptionManager(3, DropOldest, 0)
+	conn := &Connection{}
+	sub := sm.AddSubscription(conn, "sub", []*nostr.Filter{{Kinds: []int{1}}})
+	dropped := eventsDropped.Value()
+
+	for i := 0; i < 5; i++ {
+		sm.BroadcastEvent(&nostr.Event{ID: strconv.Itoa(i), Kind: 1})
+	}
+	if eventsDropped.Value() != dropped+2 || conn.Dropped() != 2 {
+		t.Errorf("%v dropped, %d on the connection, want 2", eventsDropped.Value()-dropped, conn.Dropped())
+	}
+	for _, want := range []string{"2", "3", "4"} {
+		event := <-sub.Events
+		if event.ID != want {
+			t.Errorf("got event %s, want %s", event.ID, want)
+		}
+	}
+	if len(sub.Events) != 0 {
+		t.Errorf("%d events left buffered", len(sub.Events))
+	}
+}
+
+func TestDisconnectPolicyClosesSlowConnection(t *testing.T) {
+	conn, client := connectionPair(t)
+	sm := NewSubscriptionManager(1, Disconnect, 0)
+	sm.AddSubscription(conn, "sub", []*nostr.Filter{{Kinds: []int{1}}})
+	dropped := eventsDropped.Value()
+
+	for i := 0; i < 3; i++ {
+		sm.BroadcastEvent(&nostr.Event{ID: strconv.Itoa(i), Kind: 1})
+	}
+	if eventsDropped.Value() != dropped+2 {
+		t.Errorf("%v dropped, want 2", eventsDropped.Value()-dropped)
+	}
+
+	msg := readMessage(t, client)
+	var label, notice string
+	_ = json.Unmarshal(msg[0], &label)
+	_ = json.Unmarshal(msg[1], &notice)
+	if label != "NOTICE" || !strings.Contains(notice, "subscription sub could not keep up") {
+		t.Errorf("got %s %q, want a NOTICE", label, notice)
+	}
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("got %v, want a policy violation close", err)
+	}
+}
@@ -0,0 +1,140 @@
+package nip09
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openagentsinc/v3/relay/internal/store"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+const KindDeletion = 5
+
+// HandleDeletionRequest removes every event referenced by the deletion
+// request's "e" and "a" tags that was authored by the requester. Targets
+// owned by someone else are left untouched.
+func HandleDeletionRequest(s store.Store, deletion *nostr.Event) error {
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "e":
+			err := deleteByID(s, deletion, tag[1])
+			if err != nil {
+				return err
+			}
+		case "a":
+			err := deleteByAddress(s, deletion, tag[1])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsDeleted reports whether the event's author has already requested its
+// deletion, so the relay can refuse to store it again.
+func IsDeleted(s store.Store, event *nostr.Event) bool {
+	if event.Kind == KindDeletion {
+		return false
+	}
+
+	deletions, err := s.QueryEvents(&nostr.Filter{
+		Authors: []string{event.PubKey},
+		Kinds:   []int{KindDeletion},
+	})
+	if err != nil {
+		return false
+	}
+
+	address := addressOf(event)
+	for _, deletion := range deletions {
+		for _, tag := range deletion.Tags {
+			if len(tag) < 2 {
+				continue
+			}
+			if tag[0] == "e" && tag[1] == event.ID {
+				return true
+			}
+			if tag[0] == "a" && address != "" && tag[1] == address && event.CreatedAt <= deletion.CreatedAt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func deleteByID(s store.Store, deletion *nostr.Event, id string) error {
+	events, err := s.QueryEvents(&nostr.Filter{IDs: []string{id}})
+	if err != nil {
+		return fmt.Errorf("failed to look up event %s: %v", id, err)
+	}
+	for _, event := range events {
+		if event.PubKey != deletion.PubKey || event.Kind == KindDeletion {
+			continue
+		}
+		err = s.DeleteEvent(event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete event %s: %v", event.ID, err)
+		}
+	}
+	return nil
+}
+
+func deleteByAddress(s store.Store, deletion *nostr.Event, address string) error {
+	kind, pubkey, identifier, ok := parseAddress(address)
+	if !ok || pubkey != deletion.PubKey {
+		return nil
+	}
+
+	events, err := s.QueryEvents(&nostr.Filter{
+		Authors: []string{pubkey},
+		Kinds:   []int{kind},
+		Until:   deletion.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to look up address %s: %v", address, err)
+	}
+	for _, event := range events {
+		if dTag(event) != identifier {
+			continue
+		}
+		err = s.DeleteEvent(event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete event %s: %v", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// parseAddress splits a "<kind>:<pubkey>:<d-identifier>" coordinate.
+func parseAddress(address string) (int, string, string, bool) {
+	parts := strings.SplitN(address, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", "", false
+	}
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", "", false
+	}
+	return kind, parts[1], parts[2], true
+}
+
+func addressOf(event *nostr.Event) string {
+	if !nostr.IsAddressableKind(event.Kind) {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, dTag(event))
+}
+
+func dTag(event *nostr.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package nip09
+
+import (
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/internal/store"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+func sign(t *testing.T, secretKey string, event *nostr.Event) *nostr.Event {
+	t.Helper()
+	if event.Tags == nil {
+		event.Tags = [][]string{}
+	}
+	err := event.Sign(secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func stored(t *testing.T, s store.Store, id string) bool {
+	t.Helper()
+	events, err := s.QueryEvents(&nostr.Filter{IDs: []string{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(events) > 0
+}
+
+func TestDeletionByAuthor(t *testing.T) {
+	s := store.NewMemoryStore()
+	author := newKey(t)
+	note := sign(t, author, &nostr.Event{CreatedAt: 1000, Kind: 1, Content: "hello"})
+	_ = s.SaveEvent(note)
+
+	deletion := sign(t, author, &nostr.Event{CreatedAt: 1001, Kind: KindDeletion, Tags: [][]string{{"e", note.ID}}})
+	err := HandleDeletionRequest(s, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.SaveEvent(deletion)
+
+	if stored(t, s, note.ID) {
+		t.Error("event deleted by its author is still stored")
+	}
+	if !IsDeleted(s, note) {
+		t.Error("event deleted by its author may be stored again")
+	}
+}
+
+func TestDeletionOfSomeoneElsesEventIsRefused(t *testing.T) {
+	s := store.NewMemoryStore()
+	victim := newKey(t)
+	note := sign(t, victim, &nostr.Event{CreatedAt: 1000, Kind: 1, Content: "hello"})
+	_ = s.SaveEvent(note)
+	victimPubKey, _ := nostr.GetPublicKey(victim)
+
+	attacker := newKey(t)
+	deletion := sign(t, attacker, &nostr.Event{
+		CreatedAt: 1001,
+		Kind:      KindDeletion,
+		Tags: [][]string{
+			{"e", note.ID},
+			{"a", "30023:" + victimPubKey + ":post"},
+		},
+	})
+	err := HandleDeletionRequest(s, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.SaveEvent(deletion)
+
+	if !stored(t, s, note.ID) {
+		t.Error("event was deleted by someone other than its author")
+	}
+	if IsDeleted(s, note) {
+		t.Error("deletion by someone else marks the event deleted")
+	}
+}
+
+func TestDeletionByAddress(t *testing.T) {
+	s := store.NewMemoryStore()
+	author := newKey(t)
+	pubKey, _ := nostr.GetPublicKey(author)
+	post := sign(t, author, &nostr.Event{CreatedAt: 1000, Kind: 30023, Tags: [][]string{{"d", "post"}}, Content: "draft"})
+	other := sign(t, author, &nostr.Event{CreatedAt: 1000, Kind: 30023, Tags: [][]string{{"d", "other"}}, Content: "kept"})
+	_ = s.SaveEvent(post)
+	_ = s.SaveEvent(other)
+
+	deletion := sign(t, author, &nostr.Event{CreatedAt: 1001, Kind: KindDeletion, Tags: [][]string{{"a", "30023:" + pubKey + ":post"}}})
+	err := HandleDeletionRequest(s, deletion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.SaveEvent(deletion)
+
+	if stored(t, s, post.ID) || !IsDeleted(s, post) {
+		t.Error("addressed event was not deleted")
+	}
+	if !stored(t, s, other.ID) {
+		t.Error("event with another d tag was deleted")
+	}
+	// Versions published after the deletion are not affected
+	newer := sign(t, author, &nostr.Event{CreatedAt: 1002, Kind: 30023, Tags: [][]string{{"d", "post"}}, Content: "final"})
+	if IsDeleted(s, newer) {
+		t.Error("version newer than the deletion is refused")
+	}
+}
+
+func TestDeletionRequestsCannotBeDeleted(t *testing.T) {
+	s := store.NewMemoryStore()
+	author := newKey(t)
+	first := sign(t, author, &nostr.Event{CreatedAt: 1000, Kind: KindDeletion, Tags: [][]string{{"e", "0000"}}})
+	_ = s.SaveEvent(first)
+
+	second := sign(t, author, &nostr.Event{CreatedAt: 1001, Kind: KindDeletion, Tags: [][]string{{"e", first.ID}}})
+	err := HandleDeletionRequest(s, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored(t, s, first.ID) || IsDeleted(s, first) {
+		t.Error("deletion request was deleted")
+	}
+}
@@ -0,0 +1,50 @@
+package nip11
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const ContentType = "application/nostr+json"
+
+// RelayInformation is the NIP-11 relay information document.
+type RelayInformation struct {
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	Software      string        `json:"software"`
+	SupportedNIPs []int         `json:"supported_nips"`
+	Limitation    *Limitation   `json:"limitation,omitempty"`
+	Services      []ServiceInfo `json:"nip90_services,omitempty"`
+}
+
+// Limitation advertises the limits the relay enforces on client messages.
+type Limitation struct {
+	MaxMessageLength int  `json:"max_message_length,omitempty"`
+	MaxFilters       int  `json:"max_filters,omitempty"`
+	MaxSubidLength   int  `json:"max_subid_length,omitempty"`
+	AuthRequired     bool `json:"auth_required"`
+}
+
+// ServiceInfo advertises a NIP-90 job kind and the proof of work its
+// requests must carry.
+type ServiceInfo struct {
+	Kind             int    `json:"kind"`
+	ResultKind       int    `json:"result_kind"`
+	Name             string `json:"name"`
+	Description      string `json:"description,omitempty"`
+	MinPowDifficulty int    `json:"min_pow_difficulty,omitempty"`
+	// PubKey signs the service's results and feedback.
+	PubKey string `json:"pubkey,omitempty"`
+}
+
+// IsInformationRequest reports whether an HTTP request asks for the relay
+// information document rather than a websocket upgrade.
+func IsInformationRequest(req *http.Request) bool {
+	return req.Header.Get("Accept") == ContentType
+}
+
+func WriteInformation(w http.ResponseWriter, info *RelayInformation) error {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	return json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,117 @@
+package nip40
+
+import (
+	"container/heap"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/internal/store"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// Expiration returns the time carried by the event's "expiration" tag.
+func Expiration(event *nostr.Event) (time.Time, bool) {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "expiration" {
+			seconds, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(seconds, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func IsExpired(event *nostr.Event, now time.Time) bool {
+	expiration, ok := Expiration(event)
+	return ok && !now.Before(expiration)
+}
+
+// Reaper purges events from a store once their expiration passes. It keeps
+// its own index of the expiring events it was told about, ordered by
+// expiration, so each run only looks at the events that are due rather than
+// scanning the whole store. Events deleted earlier by other means stay in
+// the index until they expire; deleting them again is harmless.
+type Reaper struct {
+	store store.Store
+	due   expiryQueue
+	mu    sync.Mutex
+}
+
+func NewReaper(s store.Store) *Reaper {
+	return &Reaper{store: s}
+}
+
+// Track indexes a stored event if it carries an expiration tag.
+func (r *Reaper) Track(event *nostr.Event) {
+	expiration, ok := Expiration(event)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	heap.Push(&r.due, expiring{id: event.ID, at: expiration})
+}
+
+// Run purges expired events every interval until stop is closed.
+func (r *Reaper) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			r.Reap(now)
+		}
+	}
+}
+
+// Reap deletes the tracked events that have expired by now and returns how
+// many it deleted.
+func (r *Reaper) Reap(now time.Time) int {
+	r.mu.Lock()
+	var ids []string
+	for r.due.Len() > 0 && !now.Before(r.due[0].at) {
+		ids = append(ids, heap.Pop(&r.due).(expiring).id)
+	}
+	r.mu.Unlock()
+
+	removed := 0
+	for _, id := range ids {
+		err := r.store.DeleteEvent(id)
+		if err != nil {
+			logging.Default().Error("Error deleting expired event", "event_id", id, "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logging.Default().Info("Removed expired events", "count", removed)
+	}
+	return removed
+}
+
+type expiring struct {
+	id string
+	at time.Time
+}
+
+// expiryQueue is a min-heap of events by expiration.
+type expiryQueue []expiring
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiring)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
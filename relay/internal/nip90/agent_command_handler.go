@@ -1,41 +1,44 @@
 package nip90
 
 import (
-	"log"
-
-	"github.com/gorilla/websocket"
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
-func HandleAgentCommandRequest(conn *websocket.Conn, event *nostr.Event) {
-	// Log all of the fields of the event, one per line
-	LogEventDetails(event)
+func (h *Handlers) HandleAgentCommandRequest(conn ResponseWriter, event *nostr.Event) {
+	log := loggerFor(conn)
+	ctx := contextFor(conn)
+	LogEventDetails(log, event)
 
 	// Extract the repo parameter
 	repo := extractRepoParam(event)
 	if repo == "" {
-		log.Println("Error: No repo parameter found in the event tags")
-		SendAgentCommandResponse(conn, "Error: No repo parameter found")
+		log.Warn("No repo parameter found in the event tags")
+		SendAgentCommandResponse(conn, event, "Error: No repo parameter found")
 		return
 	}
 
 	// Extract the user's prompt from the "i" tag
 	prompt := extractPrompt(event)
 	if prompt == "" {
-		log.Println("Error: No prompt found in the event tags")
-		SendAgentCommandResponse(conn, "Error: No prompt found")
+		log.Warn("No prompt found in the event tags")
+		SendAgentCommandResponse(conn, event, "Error: No prompt found")
 		return
 	}
 
-	log.Printf("Received agent command request for repo: %s", repo)
-	log.Printf("User prompt: %s", prompt)
+	log.Info("Received agent command request", "repo", repo, "prompt", prompt)
 
-	// Get repository context
-	context := GetRepoContext(repo, conn, prompt)
-	log.Printf("Repository context: %s", context)
+	// Get repository context, streaming the answer as partial feedback
+	partial := newPartialFeedback(conn, event)
+	context := h.GetRepoContext(ctx, repo, conn, event, prompt, partial.add)
+	log.Debug("Repository context", "context", context)
+	if ctx.Err() != nil {
+		log.Warn("Job cancelled, it will be resumed", "error", ctx.Err())
+		return
+	}
+	partial.flush()
 
 	// Send the response back to the client
-	SendAgentCommandResponse(conn, context)
+	SendAgentCommandResponse(conn, event, context)
 }
 
 func extractRepoParam(event *nostr.Event) string {
@@ -1,27 +1,52 @@
 package nip90
 
 import (
-	"fmt"
-	"log"
 	"strings"
 
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
-func LogEventDetails(event *nostr.Event) {
-	var sb strings.Builder
+// tagValueLogLength caps each tag value in logs; "i" tags can hold whole
+// base64 recordings.
+const tagValueLogLength = 64
 
-	sb.WriteString("Event Details:\n")
-	sb.WriteString(fmt.Sprintf("  ID: %s\n", event.ID))
-	sb.WriteString(fmt.Sprintf("  PubKey: %s\n", event.PubKey))
-	sb.WriteString(fmt.Sprintf("  CreatedAt: %s\n", event.CreatedAt))
-	sb.WriteString(fmt.Sprintf("  Kind: %d\n", event.Kind))
-	sb.WriteString("  Tags:\n")
+// LogEventDetails logs a summary of the event at debug level. The signature
+// is omitted and tag values and content are truncated.
+func LogEventDetails(log *logging.Logger, event *nostr.Event) {
+	if !log.Enabled(logging.LevelDebug) {
+		return
+	}
+
+	tags := make([]string, 0, len(event.Tags))
 	for _, tag := range event.Tags {
-		sb.WriteString(fmt.Sprintf("    - %v\n", tag))
+		values := make([]string, len(tag))
+		for i, value := range tag {
+			values[i] = logging.Truncate(value, tagValueLogLength)
+		}
+		tags = append(tags, "["+strings.Join(values, " ")+"]")
 	}
-	sb.WriteString(fmt.Sprintf("  Content: %s\n", event.Content))
-	sb.WriteString(fmt.Sprintf("  Sig: %s\n", event.Sig))
 
-	log.Print(sb.String())
-}
\ No newline at end of file
+	log.Debug("Event details",
+		"event_id", event.ID,
+		"pubkey", event.PubKey,
+		"created_at", event.CreatedAt,
+		"kind", event.Kind,
+		"tags", strings.Join(tags, " "),
+		"content", event.Content,
+		"content_bytes", len(event.Content),
+	)
+}
+
+// loggerProvider is implemented by writers that carry a logger correlated
+// with a connection or job.
+type loggerProvider interface {
+	Logger() *logging.Logger
+}
+
+func loggerFor(conn ResponseWriter) *logging.Logger {
+	if p, ok := conn.(loggerProvider); ok {
+		return p.Logger()
+	}
+	return logging.Default()
+}
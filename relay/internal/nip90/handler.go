@@ -1,56 +1,49 @@
 package nip90
 
 import (
-	"log"
-	"time"
+	"encoding/base64"
 
-	"github.com/gorilla/websocket"
-	"github.com/openagentsinc/v3/relay/internal/nostr"
-	"github.com/openagentsinc/v3/relay/internal/groq"
-	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/internal/github"
+	"github.com/openagentsinc/v3/relay/internal/llm"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
+// Handlers implements the built-in NIP-90 services on top of a language
+// model, a transcriber and the GitHub client.
+type Handlers struct {
+	LLM           llm.LLM
+	Transcriber   llm.Transcriber
+	GitHub        *github.Client
+	MaxIterations int
+	MaxWords      int
+}
+
 type AudioData struct {
 	Data   string
 	Format string
 }
 
-func HandleAudioMessage(conn *websocket.Conn, event *nostr.Event) {
+func (h *Handlers) HandleAudioMessage(conn ResponseWriter, event *nostr.Event) {
+	log := loggerFor(conn)
+	ctx := contextFor(conn)
 	audioData := extractAudioData(event)
-	log.Printf("Received audio message. Format: %s, Length: %d\n", audioData.Format, len(audioData.Data))
+	log.Info("Received audio message", "format", audioData.Format, "audio_bytes", len(audioData.Data))
 
-	// Transcribe the audio using Groq API
-	transcription, err := groq.TranscribeAudio(audioData.Data, audioData.Format)
-	if err != nil {
-		log.Printf("Error transcribing audio: %v", err)
-		transcription = "Error transcribing audio"
+	var transcription string
+	audio, err := base64.StdEncoding.DecodeString(audioData.Data)
+	if err == nil {
+		transcription, err = h.Transcriber.Transcribe(ctx, audio, audioData.Format)
 	}
-
-	// Create a response event
-	responseEvent := &nostr.Event{
-		Kind:      6252, // Updated event kind for transcription response
-		Content:   transcription,
-		CreatedAt: time.Now(),
-		Tags:      [][]string{},
+	if ctx.Err() != nil {
+		log.Warn("Job cancelled, it will be resumed", "error", ctx.Err())
+		return
 	}
-
-	// Send the response back to the client
-	response := common.CreateEventMessage(responseEvent)
-	err = conn.WriteJSON(response)
 	if err != nil {
-		log.Println("Error writing audio response to WebSocket:", err)
+		log.Error("Error transcribing audio", "error", err)
+		transcription = "Error transcribing audio"
 	}
-}
 
-func HandleNIP90Event(conn *websocket.Conn, event *nostr.Event) {
-	switch event.Kind {
-	case 5252:
-		HandleAudioMessage(conn, event)
-	case 5838:
-		HandleAgentCommandRequest(conn, event)
-	default:
-		log.Printf("Unhandled NIP-90 event kind: %d", event.Kind)
-	}
+	sendJobResult(conn, event, 6252, transcription) // Event kind for transcription response
 }
 
 func extractAudioData(event *nostr.Event) *AudioData {
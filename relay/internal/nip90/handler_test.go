@@ -0,0 +1,313 @@
+package nip90
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/internal/github"
+	"github.com/openagentsinc/v3/relay/internal/llm"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// fakeWriter records the events a handler writes.
+type fakeWriter struct {
+	ctx    context.Context
+	events []*nostr.Event
+	mu     sync.Mutex
+}
+
+func (w *fakeWriter) WriteJSON(v interface{}) error {
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) < 2 || msg[0] != "EVENT" {
+		return nil
+	}
+	if event, ok := msg[len(msg)-1].(*nostr.Event); ok {
+		w.mu.Lock()
+		w.events = append(w.events, event)
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+func (w *fakeWriter) JobContext() context.Context {
+	if w.ctx == nil {
+		return context.Background()
+	}
+	return w.ctx
+}
+
+// ofKind returns the written events of kind.
+func (w *fakeWriter) ofKind(kind int) []*nostr.Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var events []*nostr.Event
+	for _, event := range w.events {
+		if event.Kind == kind {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// result returns the single job result of kind, failing the test otherwise.
+func (w *fakeWriter) result(t *testing.T, kind int, request *nostr.Event) *nostr.Event {
+	t.Helper()
+	results := w.ofKind(kind)
+	if len(results) != 1 {
+		t.Fatalf("got %d results of kind %d, want 1", len(results), kind)
+	}
+	if !referencesRequest(results[0], request) {
+		t.Errorf("result does not reference the request: %v", results[0].Tags)
+	}
+	return results[0]
+}
+
+func referencesRequest(event, request *nostr.Event) bool {
+	e, p := false, false
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "e" && tag[1] == request.ID {
+			e = true
+		}
+		if len(tag) >= 2 && tag[0] == "p" && tag[1] == request.PubKey {
+			p = true
+		}
+	}
+	return e && p
+}
+
+// newGitHubStub serves a repository with a cmd folder and a README.
+func newGitHubStub(t *testing.T) *github.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/openagentsinc/v3/contents/":
+			_ = json.NewEncoder(w).Encode([]github.GitHubItem{
+				{Type: "dir", Name: "cmd", Path: "cmd"},
+				{Type: "file", Name: "README.md", Path: "README.md"},
+			})
+		case "/repos/openagentsinc/v3/contents/README.md":
+			_ = json.NewEncoder(w).Encode(github.GitHubFile{
+				Content:  base64.StdEncoding.EncodeToString([]byte("# v3\n")),
+				Encoding: "base64",
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return github.NewClient(github.Config{Token: "test-token", BaseURL: server.URL})
+}
+
+func testHandlers(t *testing.T) *Handlers {
+	return &Handlers{
+		LLM:           llm.Fake{},
+		Transcriber:   llm.Fake{},
+		GitHub:        newGitHubStub(t),
+		MaxIterations: 3,
+		MaxWords:      75,
+	}
+}
+
+func agentCommand(t *testing.T, prompt string) *nostr.Event {
+	return signedRequest(t, 5838, []string{"i", prompt, "text"}, []string{"param", "repo", "openagentsinc/v3"})
+}
+
+func TestHandleAgentCommandRequest(t *testing.T) {
+	h := testHandlers(t)
+	conn := &fakeWriter{}
+	request := agentCommand(t, "What does this repository do?")
+
+	h.HandleAgentCommandRequest(conn, request)
+
+	result := conn.result(t, 6838, request)
+	if !strings.HasPrefix(result.Content, "Fake response to: ") {
+		t.Errorf("unexpected answer %q", result.Content)
+	}
+	if len(conn.ofKind(7000)) == 0 {
+		t.Error("the streamed answer sent no partial feedback")
+	}
+}
+
+// viewingLLM asks to view the README once, then answers.
+type viewingLLM struct {
+	llm.Fake
+	calls int
+}
+
+func (l *viewingLLM) Chat(ctx context.Context, messages []llm.Message, tools []llm.Tool) (*llm.Response, error) {
+	l.calls++
+	if l.calls == 1 && tools != nil {
+		call := llm.ToolCall{ID: "call_1", Type: "function"}
+		call.Function.Name = "view_file"
+		call.Function.Arguments = `{"path":"README.md"}`
+		return &llm.Response{Role: "assistant", ToolCalls: []llm.ToolCall{call}}, nil
+	}
+	return l.Fake.Chat(ctx, messages, tools)
+}
+
+func TestViewedFilesAreReportedAsFeedback(t *testing.T) {
+	h := testHandlers(t)
+	h.LLM = &viewingLLM{}
+	conn := &fakeWriter{}
+	request := agentCommand(t, "What does this repository do?")
+
+	h.HandleAgentCommandRequest(conn, request)
+
+	// Only the answer is a result; the file view is feedback on the request
+	conn.result(t, 6838, request)
+	var viewed []*nostr.Event
+	for _, event := range conn.ofKind(7000) {
+		if len(event.Tags) > 0 && len(event.Tags[0]) == 3 && event.Tags[0][2] == "Viewed README.md" {
+			viewed = append(viewed, event)
+		}
+	}
+	if len(viewed) != 1 {
+		t.Fatalf("got %d file view notices, want 1", len(viewed))
+	}
+	if viewed[0].Tags[0][1] != "processing" || !referencesRequest(viewed[0], request) {
+		t.Errorf("unexpected file view notice %v", viewed[0].Tags)
+	}
+}
+
+func TestHandleAgentCommandStructuralQuestion(t *testing.T) {
+	h := testHandlers(t)
+	conn := &fakeWriter{}
+	request := agentCommand(t, "What folders are there?")
+
+	h.HandleAgentCommandRequest(conn, request)
+
+	result := conn.result(t, 6838, request)
+	if !strings.HasSuffix(result.Content, "\n\ncmd") {
+		t.Errorf("unexpected answer %q", result.Content)
+	}
+}
+
+func TestHandleAgentCommandWithoutRepo(t *testing.T) {
+	h := testHandlers(t)
+	conn := &fakeWriter{}
+	request := signedRequest(t, 5838, []string{"i", "What does this repository do?", "text"})
+
+	h.HandleAgentCommandRequest(conn, request)
+
+	if result := conn.result(t, 6838, request); result.Content != "Error: No repo parameter found" {
+		t.Errorf("unexpected answer %q", result.Content)
+	}
+}
+
+func TestHandleAudioMessage(t *testing.T) {
+	h := testHandlers(t)
+	tests := []struct {
+		name  string
+		audio string
+		want  string
+	}{
+		{"transcribed", base64.StdEncoding.EncodeToString([]byte("audio")), "Fake transcription of 5 bytes of mp3 audio"},
+		{"not base64", "%%%", "Error transcribing audio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeWriter{}
+			request := signedRequest(t, 5252, []string{"i", tt.audio}, []string{"param", "format", "mp3"})
+
+			h.HandleAudioMessage(conn, request)
+
+			if result := conn.result(t, 6252, request); result.Content != tt.want {
+				t.Errorf("got %q, want %q", result.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelledJobsSendNoResult(t *testing.T) {
+	h := testHandlers(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	conn := &fakeWriter{ctx: ctx}
+	h.HandleAudioMessage(conn, signedRequest(t, 5252, []string{"i", "YXVkaW8="}))
+	h.HandleAgentCommandRequest(conn, agentCommand(t, "What does this repository do?"))
+
+	if len(conn.ofKind(6252)) != 0 || len(conn.ofKind(6838)) != 0 {
+		t.Error("cancelled jobs sent a result")
+	}
+}
+
+// directRecorder is a fakeWriter that also records what is written only
+// to the submitting connection.
+type directRecorder struct {
+	fakeWriter
+	direct []*nostr.Event
+}
+
+func (w *directRecorder) WriteDirect(v interface{}) error {
+	if msg, ok := v.([]interface{}); ok {
+		if event, ok := msg[len(msg)-1].(*nostr.Event); ok {
+			w.mu.Lock()
+			w.direct = append(w.direct, event)
+			w.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func TestPartialFeedbackIsOnlyWrittenDirectly(t *testing.T) {
+	h := testHandlers(t)
+	// The fake answer runs past this, which must not cut the result short
+	h.MaxWords = 5
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5838, ResultKind: 6838, Handle: h.HandleAgentCommandRequest})
+	queue := NewQueue(registry, 1, 1, "")
+	outbox := &fakeOutbox{}
+	queue.SetProvider("", outbox)
+	conn := &directRecorder{}
+	request := signedRequest(t, 5838,
+		[]string{"i", "What does this repository do?", "text"},
+		[]string{"param", "repo", "openagentsinc/v3"},
+		[]string{"relays", "wss://relay.example.com"})
+
+	err := queue.Enqueue(conn, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Close()
+	queue.wg.Wait()
+
+	if len(conn.direct) == 0 {
+		t.Fatal("no partial feedback written directly")
+	}
+	var partial strings.Builder
+	for _, event := range conn.direct {
+		if event.Kind != 7000 || event.Tags[0][1] != "partial" {
+			t.Errorf("unexpected direct event %+v", event)
+		}
+		partial.WriteString(event.Content)
+	}
+	result := conn.result(t, 6838, request)
+	// The partial feedback adds up to the whole answer, which the result
+	// carries in full
+	if partial.String() != result.Content {
+		t.Errorf("partial feedback %q does not match the result %q", partial.String(), result.Content)
+	}
+	if len(conn.ofKind(7000)) != 0 {
+		t.Error("partial feedback was written as regular output")
+	}
+	for _, event := range outbox.published {
+		if event.Kind == 7000 {
+			t.Error("partial feedback was published to other relays")
+		}
+	}
+	if len(outbox.published) != 1 || outbox.published[0].ID != result.ID {
+		t.Errorf("published %d events, want only the result", len(outbox.published))
+	}
+}
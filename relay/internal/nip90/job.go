@@ -0,0 +1,114 @@
+package nip90
+
+import (
+	"context"
+
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+type JobStatus string
+
+const (
+	JobQueued     JobStatus = "queued"
+	JobProcessing JobStatus = "processing"
+	JobFinished   JobStatus = "finished"
+)
+
+// Job is a job request accepted by the relay together with where to send
+// its results. Handlers receive the job as their ResponseWriter, which lets
+// them checkpoint partial progress.
+type Job struct {
+	Request *nostr.Event `json:"request"`
+	Status  JobStatus    `json:"status"`
+	// Context is the partial work saved by the handler, used to resume the
+	// job after a restart.
+	Context string `json:"context,omitempty"`
+	// Source is the upstream relay the request was taken from in provider
+	// mode; output goes back there instead of to a local connection.
+	Source string `json:"source,omitempty"`
+
+	conn  ResponseWriter
+	queue *Queue
+	log   *logging.Logger
+	// dropped is set under the queue's lock when the request is deleted
+	// before its job starts.
+	dropped bool
+}
+
+func (j *Job) Logger() *logging.Logger {
+	return j.log
+}
+
+// JobContext is cancelled when shutdown stops waiting for the job.
+func (j *Job) JobContext() context.Context {
+	return j.queue.ctx
+}
+
+func (j *Job) WriteJSON(v interface{}) error {
+	return j.conn.WriteJSON(v)
+}
+
+// WriteDirect writes v only to the connection that submitted the job. Jobs
+// without one, such as those taken from upstream relays, drop it.
+func (j *Job) WriteDirect(v interface{}) error {
+	if w, ok := j.conn.(directWriter); ok {
+		return w.WriteDirect(v)
+	}
+	return nil
+}
+
+// SignOutput signs an event produced by the job with the provider key.
+func (j *Job) SignOutput(event *nostr.Event) error {
+	return j.queue.signOutput(event)
+}
+
+// PublishOutput copies an event produced by the job to other relays.
+func (j *Job) PublishOutput(event *nostr.Event, relays []string) {
+	j.queue.publishOutput(event, relays)
+}
+
+// RecordResult remembers the result for resubmissions of the request.
+func (j *Job) RecordResult(result *nostr.Event) {
+	j.queue.results.Add(j.Request.ID, result)
+}
+
+func (j *Job) SaveProgress(context string) {
+	j.queue.saveProgress(j, context)
+}
+
+func (j *Job) SavedProgress() string {
+	return j.queue.savedProgress(j)
+}
+
+// progressWriter is implemented by writers that can checkpoint a job's
+// partial progress.
+type progressWriter interface {
+	SaveProgress(context string)
+	SavedProgress() string
+}
+
+func saveProgress(conn ResponseWriter, context string) {
+	if p, ok := conn.(progressWriter); ok {
+		p.SaveProgress(context)
+	}
+}
+
+func savedProgress(conn ResponseWriter) string {
+	if p, ok := conn.(progressWriter); ok {
+		return p.SavedProgress()
+	}
+	return ""
+}
+
+// contextProvider is implemented by writers whose job can be cancelled.
+type contextProvider interface {
+	JobContext() context.Context
+}
+
+func contextFor(conn ResponseWriter) context.Context {
+	if p, ok := conn.(contextProvider); ok {
+		return p.JobContext()
+	}
+	return context.Background()
+}
@@ -0,0 +1,272 @@
+package nip90
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/internal/nip40"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// journal keeps unfinished jobs on disk so they can be resumed after a
+// restart. The index file lists each job with its status; the request and
+// saved context, which can be large, go in a file per job in a directory
+// next to it. A request's file is written when the job is queued and again
+// only when its handler saves progress, so status changes rewrite the index
+// alone.
+//
+// The journal has its own lock so that no file is written while the queue
+// is locked. A nil journal keeps nothing.
+type journal struct {
+	path    string
+	dir     string
+	entries map[string]*journalEntry
+	mu      sync.Mutex
+}
+
+// journalEntry is one job in the index.
+type journalEntry struct {
+	ID     string    `json:"id"`
+	Kind   int       `json:"kind"`
+	PubKey string    `json:"pubkey"`
+	Status JobStatus `json:"status"`
+	Source string    `json:"source,omitempty"`
+	// File holds the request and saved context, relative to the journal's
+	// directory.
+	File string `json:"file"`
+
+	request *nostr.Event
+}
+
+// jobFile is the content of a job's file.
+type jobFile struct {
+	Request *nostr.Event `json:"request"`
+	Context string       `json:"context,omitempty"`
+}
+
+// openJournal returns the journal with its index at path and job files in a
+// directory named after it, such as jobs/ for jobs.json.
+func openJournal(path string) *journal {
+	if path == "" {
+		return nil
+	}
+	return &journal{
+		path:    path,
+		dir:     strings.TrimSuffix(path, filepath.Ext(path)),
+		entries: make(map[string]*journalEntry),
+	}
+}
+
+// load reads the jobs left by the last run. Jobs whose request has expired
+// or whose file cannot be read are dropped, as are files no entry refers
+// to. A missing index means no jobs.
+func (j *journal) load() ([]*Job, error) {
+	if j == nil {
+		return nil, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs file: %v", err)
+	}
+	var entries []*journalEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jobs file: %v", err)
+	}
+
+	log := logging.Default()
+	now := time.Now()
+	var jobs []*Job
+	j.entries = make(map[string]*journalEntry)
+	for _, entry := range entries {
+		var f jobFile
+		data, err := os.ReadFile(filepath.Join(j.dir, entry.File))
+		if err == nil {
+			err = json.Unmarshal(data, &f)
+		}
+		if err == nil && (f.Request == nil || f.Request.ID != entry.ID) {
+			err = fmt.Errorf("file holds another request")
+		}
+		if err != nil {
+			log.Error("Dropping unreadable job", "job_id", entry.ID, "file", entry.File, "error", err)
+			continue
+		}
+		if nip40.IsExpired(f.Request, now) {
+			log.Info("Dropping expired job", "job_id", entry.ID)
+			continue
+		}
+		entry.request = f.Request
+		j.entries[entry.ID] = entry
+		jobs = append(jobs, &Job{Request: f.Request, Status: entry.Status, Context: f.Context, Source: entry.Source})
+	}
+
+	files, err := os.ReadDir(j.dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("Error listing job files", "dir", j.dir, "error", err)
+	}
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), ".json")
+		if _, ok := j.entries[id]; !ok {
+			j.removeFile(file.Name())
+		}
+	}
+	j.writeIndex()
+	return jobs, nil
+}
+
+// add records a newly queued job, replacing any entry for the same request.
+func (j *journal) add(job *Job) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id := job.Request.ID
+	if !validID(id) {
+		logging.Default().Error("Not journaling job with malformed ID", "job_id", id)
+		return
+	}
+	entry := &journalEntry{
+		ID:      id,
+		Kind:    job.Request.Kind,
+		PubKey:  job.Request.PubKey,
+		Status:  job.Status,
+		Source:  job.Source,
+		File:    id + ".json",
+		request: job.Request,
+	}
+	if !j.writeJobFile(entry, job.Context) {
+		return
+	}
+	j.entries[id] = entry
+	j.writeIndex()
+}
+
+// setStatus records a job's new status, if it is still journaled.
+func (j *journal) setStatus(id string, status JobStatus) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[id]
+	if !ok || entry.Status == status {
+		return
+	}
+	entry.Status = status
+	j.writeIndex()
+}
+
+// saveContext records the partial work of a job, if it is still journaled.
+func (j *journal) saveContext(id, context string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if entry, ok := j.entries[id]; ok {
+		j.writeJobFile(entry, context)
+	}
+}
+
+// remove forgets a finished or dropped job.
+func (j *journal) remove(id string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.entries[id]
+	if !ok {
+		return
+	}
+	delete(j.entries, id)
+	// Update the index first so it never refers to a missing file
+	j.writeIndex()
+	j.removeFile(entry.File)
+}
+
+// writeJobFile reports whether the job's file was written. Callers must
+// hold j.mu.
+func (j *journal) writeJobFile(entry *journalEntry, context string) bool {
+	data, err := json.Marshal(jobFile{Request: entry.request, Context: context})
+	if err == nil {
+		err = os.MkdirAll(j.dir, 0o755)
+	}
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(j.dir, entry.File), data)
+	}
+	if err != nil {
+		logging.Default().Error("Error persisting job", "job_id", entry.ID, "error", err)
+		return false
+	}
+	return true
+}
+
+// writeIndex replaces the index with the current entries. Callers must hold
+// j.mu.
+func (j *journal) writeIndex() {
+	entries := make([]*journalEntry, 0, len(j.entries))
+	for _, entry := range j.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(j.path, data)
+	}
+	if err != nil {
+		logging.Default().Error("Error persisting jobs", "path", j.path, "error", err)
+	}
+}
+
+func (j *journal) removeFile(name string) {
+	err := os.Remove(filepath.Join(j.dir, name))
+	if err != nil && !os.IsNotExist(err) {
+		logging.Default().Error("Error removing job file", "file", name, "error", err)
+	}
+}
+
+// validID reports whether id is an event ID, and so safe to use as a file
+// name.
+func validID(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == 32
+}
+
+// writeFileAtomic writes data to a temporary file first and renames it over
+// path, so a crash never leaves a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
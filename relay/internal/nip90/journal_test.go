@@ -0,0 +1,187 @@
+package nip90
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// journaled returns the IDs listed in the journal index at path.
+func journaled(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []journalEntry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestJournalKeepsInterruptedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	started := make(chan struct{})
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(conn ResponseWriter, event *nostr.Event) {
+		saveProgress(conn, "halfway")
+		close(started)
+		<-contextFor(conn).Done()
+	}})
+	queue := NewQueue(registry, 1, 2, path)
+	running := signedRequest(t, 5252, []string{"i", "a long recording"})
+	queued := signedRequest(t, 5252)
+	for _, request := range []*nostr.Event{running, queued} {
+		err := queue.Enqueue(&fakeWriter{}, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	queue.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_ = queue.Wait(ctx)
+	queue.wg.Wait()
+
+	// The index only refers to the requests, which have a file each
+	index, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "a long recording") || strings.Contains(string(index), "halfway") {
+		t.Errorf("index holds job data: %s", index)
+	}
+	for _, request := range []*nostr.Event{running, queued} {
+		_, err := os.Stat(filepath.Join(filepath.Dir(path), "jobs", request.ID+".json"))
+		if err != nil {
+			t.Errorf("no file for request: %v", err)
+		}
+	}
+
+	jobs, err := NewQueue(registry, 0, 2, path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("loaded %d jobs, want 2", len(jobs))
+	}
+	for _, job := range jobs {
+		switch job.Request.ID {
+		case running.ID:
+			if job.Status != JobProcessing || job.Context != "halfway" {
+				t.Errorf("running job loaded as %s with context %q", job.Status, job.Context)
+			}
+		case queued.ID:
+			if job.Status != JobQueued || job.Context != "" {
+				t.Errorf("queued job loaded as %s with context %q", job.Status, job.Context)
+			}
+		default:
+			t.Errorf("loaded unknown job %s", job.Request.ID)
+		}
+	}
+}
+
+func TestJournalRemovesFinishedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(ResponseWriter, *nostr.Event) {}})
+	queue := NewQueue(registry, 1, 1, path)
+	err := queue.Enqueue(&fakeWriter{}, signedRequest(t, 5252))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Close()
+	queue.wg.Wait()
+
+	if ids := journaled(t, path); len(ids) != 0 {
+		t.Errorf("finished jobs left in the journal: %v", ids)
+	}
+	files, _ := os.ReadDir(filepath.Join(filepath.Dir(path), "jobs"))
+	if len(files) != 0 {
+		t.Errorf("%d job files left behind", len(files))
+	}
+}
+
+func TestJournalDropsExpiredRequestsOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	expired := signedRequest(t, 5252, []string{"expiration", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)})
+	current := signedRequest(t, 5252)
+	j := openJournal(path)
+	j.add(&Job{Request: expired, Status: JobQueued})
+	j.add(&Job{Request: current, Status: JobQueued})
+
+	jobs, err := openJournal(path).load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Request.ID != current.ID {
+		t.Errorf("loaded %d jobs, want only the current request", len(jobs))
+	}
+	if ids := journaled(t, path); len(ids) != 1 {
+		t.Errorf("index still lists %v", ids)
+	}
+	_, err = os.Stat(filepath.Join(j.dir, expired.ID+".json"))
+	if !os.IsNotExist(err) {
+		t.Errorf("expired request file was kept: %v", err)
+	}
+}
+
+func TestQueueDropsDeletedAndExpiredRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	release := make(chan struct{})
+	var handled []string
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(conn ResponseWriter, event *nostr.Event) {
+		handled = append(handled, event.ID)
+		<-release
+	}})
+	queue := NewQueue(registry, 1, 3, path)
+	blocking := signedRequest(t, 5252)
+	deleted := signedRequest(t, 5252)
+	expired := signedRequest(t, 5252, []string{"expiration", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)})
+	for _, request := range []*nostr.Event{blocking, deleted, expired} {
+		err := queue.Enqueue(&fakeWriter{}, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the author's deletion drops the job
+	queue.Forget(deleted.ID, blocking.PubKey)
+	if !queue.Pending(deleted.ID) || len(journaled(t, path)) != 3 {
+		t.Fatal("job dropped by someone else's deletion")
+	}
+	queue.Forget(deleted.ID, deleted.PubKey)
+	for _, id := range journaled(t, path) {
+		if id == deleted.ID {
+			t.Error("deleted request is still journaled")
+		}
+	}
+
+	close(release)
+	queue.Close()
+	queue.wg.Wait()
+	if len(handled) != 1 || handled[0] != blocking.ID {
+		t.Errorf("handled %d jobs, want only the first", len(handled))
+	}
+	if queue.Pending(deleted.ID) || queue.Pending(expired.ID) {
+		t.Error("dropped jobs are still pending")
+	}
+	if ids := journaled(t, path); len(ids) != 0 {
+		t.Errorf("journal still lists %v", ids)
+	}
+}
@@ -0,0 +1,13 @@
+package nip90
+
+import (
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+var (
+	jobsTotal   = metrics.NewCounterVec("nip90_jobs_total", "NIP-90 jobs by kind and lifecycle stage (queued, started, finished, abandoned, dropped).", "kind", "stage")
+	jobsPending = metrics.NewGaugeVec("nip90_jobs_pending", "NIP-90 jobs queued or processing, by kind.", "kind")
+	jobDuration = metrics.NewHistogramVec("nip90_job_duration_seconds", "Time spent running NIP-90 jobs, by kind.", metrics.DefaultBuckets, "kind")
+
+	providerRequests = metrics.NewCounterVec("nip90_provider_requests_total", "Job requests seen on upstream relays, by kind and result (accepted, duplicate, invalid, other_provider, pow, error).", "kind", "result")
+)
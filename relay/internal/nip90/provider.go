@@ -0,0 +1,228 @@
+package nip90
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/client"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/internal/lru"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+const (
+	// providerSeenSize bounds the request IDs remembered to ignore the same
+	// request arriving from several upstream relays.
+	providerSeenSize = 10000
+	// providerDialTimeout bounds each attempt to connect to an upstream relay.
+	providerDialTimeout = 10 * time.Second
+	// providerRetryDelay is the longest wait between connection attempts.
+	providerRetryDelay = time.Minute
+)
+
+// Provider serves job requests published on other relays. It subscribes to
+// each upstream relay for the registry's job kinds, runs matching requests
+// on the queue and publishes their output back to the relay the request
+// came from.
+type Provider struct {
+	registry     *Registry
+	queue        *Queue
+	relays       []string
+	pubKey       string
+	mentionsOnly bool
+	seen         *lru.Cache
+	// seenMu is held from checking seen until a new request is queued, so
+	// a request arriving from several relays at once is taken only once.
+	seenMu  sync.Mutex
+	clients []*client.Client
+	done    chan struct{}
+	closed  bool
+	log     *logging.Logger
+	mu      sync.Mutex
+}
+
+// NewProvider watches relays for requests to the services in registry.
+// With mentionsOnly, only requests p-tagging pubKey are taken.
+func NewProvider(registry *Registry, queue *Queue, relays []string, pubKey string, mentionsOnly bool) *Provider {
+	return &Provider{
+		registry:     registry,
+		queue:        queue,
+		relays:       relays,
+		pubKey:       pubKey,
+		mentionsOnly: mentionsOnly,
+		seen:         lru.New(providerSeenSize),
+		done:         make(chan struct{}),
+		log:          logging.Default().With("component", "provider"),
+	}
+}
+
+// Start connects to the upstream relays in the background. Relays that are
+// unreachable are retried until Close.
+func (p *Provider) Start() {
+	for _, url := range p.relays {
+		go p.connect(url)
+	}
+}
+
+// Close stops taking new requests from upstream relays. Jobs already queued
+// are left to the queue.
+func (p *Provider) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	clients := p.clients
+	p.clients = nil
+	p.mu.Unlock()
+
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+func (p *Provider) connect(url string) {
+	log := p.log.With("upstream", url)
+	delay := time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), providerDialTimeout)
+		c, err := client.Dial(ctx, url, client.Options{Logger: log})
+		if err == nil {
+			_, err = c.Subscribe(ctx, []*nostr.Filter{p.filter()}, client.Callbacks{
+				OnEvent: func(event *nostr.Event) {
+					p.handleRequest(url, event)
+				},
+			})
+			if err != nil {
+				c.Close()
+			}
+		}
+		cancel()
+
+		if err == nil {
+			p.mu.Lock()
+			if p.closed {
+				p.mu.Unlock()
+				c.Close()
+				return
+			}
+			p.clients = append(p.clients, c)
+			p.mu.Unlock()
+			log.Info("Watching upstream relay for job requests")
+			return
+		}
+
+		log.Warn("Error connecting to upstream relay", "error", err, "retry_in", delay.String())
+		select {
+		case <-p.done:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > providerRetryDelay {
+			delay = providerRetryDelay
+		}
+	}
+}
+
+// filter asks for requests of every registered kind created from now on;
+// requests interrupted by a restart are resumed from the journal instead.
+func (p *Provider) filter() *nostr.Filter {
+	filter := &nostr.Filter{Since: nostr.Now()}
+	for _, service := range p.registry.Services() {
+		filter.Kinds = append(filter.Kinds, service.Kind)
+	}
+	if p.mentionsOnly {
+		filter.Tags = map[string][]string{"p": {p.pubKey}}
+	}
+	return filter
+}
+
+func (p *Provider) handleRequest(url string, event *nostr.Event) {
+	log := p.log.With("upstream", url, "job_id", event.ID, "kind", event.Kind)
+	kind := strconv.Itoa(event.Kind)
+
+	service, ok := p.registry.Lookup(event.Kind)
+	if !ok {
+		return
+	}
+	if !event.CheckSignature() {
+		log.Debug("Ignoring request with an invalid signature")
+		providerRequests.Inc(kind, "invalid")
+		return
+	}
+	if !p.addressedToUs(event) {
+		providerRequests.Inc(kind, "other_provider")
+		return
+	}
+	err := nostr.CheckProofOfWork(event, service.MinDifficulty)
+	if err != nil {
+		log.Debug("Ignoring request without enough proof of work", "error", err)
+		providerRequests.Inc(kind, "pow")
+		return
+	}
+
+	p.seenMu.Lock()
+	defer p.seenMu.Unlock()
+	if p.seen.Contains(event.ID) {
+		providerRequests.Inc(kind, "duplicate")
+		return
+	}
+	// A request that could not be queued is not remembered, so the same
+	// request from another relay gets another chance
+	err = p.queue.EnqueueFrom(url, event)
+	if errors.Is(err, ErrDuplicateJob) {
+		// Already submitted to this relay directly
+		p.seen.Add(event.ID, struct{}{})
+		providerRequests.Inc(kind, "duplicate")
+		return
+	}
+	if err != nil {
+		log.Warn("Error queuing upstream job", "error", err)
+		providerRequests.Inc(kind, "error")
+		return
+	}
+	p.seen.Add(event.ID, struct{}{})
+	providerRequests.Inc(kind, "accepted")
+	log.Info("Accepted job from upstream relay")
+}
+
+// addressedToUs reports whether a request is open to any provider or names
+// us among the providers it p-tags.
+func (p *Provider) addressedToUs(event *nostr.Event) bool {
+	tagged := false
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" {
+			if tag[1] == p.pubKey {
+				return true
+			}
+			tagged = true
+		}
+	}
+	return !tagged && !p.mentionsOnly
+}
+
+// upstreamWriter delivers the output of a job taken from another relay by
+// publishing it back to that relay.
+type upstreamWriter struct {
+	url    string
+	outbox Outbox
+}
+
+func (w *upstreamWriter) WriteJSON(v interface{}) error {
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) < 2 || msg[0] != "EVENT" {
+		return nil
+	}
+	event, ok := msg[len(msg)-1].(*nostr.Event)
+	if !ok {
+		return nil
+	}
+	w.outbox.Publish(event, []string{w.url})
+	return nil
+}
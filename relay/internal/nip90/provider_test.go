@@ -0,0 +1,106 @@
+package nip90
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+type fakeOutbox struct {
+	published []*nostr.Event
+}
+
+func (o *fakeOutbox) Publish(event *nostr.Event, relays []string) {
+	o.published = append(o.published, event)
+}
+
+func signedRequest(t *testing.T, kind int, tags ...[]string) *nostr.Event {
+	t.Helper()
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags == nil {
+		tags = [][]string{}
+	}
+	event := &nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: tags, Content: "request"}
+	err = event.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestProviderRetriesRequestThatWasNotQueued(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(ResponseWriter, *nostr.Event) {}})
+	// No workers, so queued jobs stay pending
+	queue := NewQueue(registry, 0, 1, filepath.Join(t.TempDir(), "jobs.json"))
+	provider := NewProvider(registry, queue, nil, "", false)
+	request := signedRequest(t, 5252)
+
+	// Without an outbox, upstream jobs cannot be queued
+	provider.handleRequest("wss://one.example.com", request)
+	if queue.Pending(request.ID) || provider.seen.Contains(request.ID) {
+		t.Fatal("request was taken although it could not be queued")
+	}
+
+	queue.SetProvider("", &fakeOutbox{})
+	provider.handleRequest("wss://two.example.com", request)
+	if !queue.Pending(request.ID) || !provider.seen.Contains(request.ID) {
+		t.Fatal("request from the second relay was not taken")
+	}
+
+	// Once queued, copies from other relays are duplicates
+	provider.handleRequest("wss://three.example.com", request)
+	if n := len(queue.Unfinished()); n != 1 {
+		t.Errorf("%d jobs queued, want 1", n)
+	}
+}
+
+func TestProviderSkipsRequestsForOtherProviders(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(ResponseWriter, *nostr.Event) {}})
+	queue := NewQueue(registry, 0, 10, "")
+	queue.SetProvider("", &fakeOutbox{})
+	provider := NewProvider(registry, queue, nil, "ourpubkey", true)
+
+	open := signedRequest(t, 5252)
+	other := signedRequest(t, 5252, []string{"p", "theirpubkey"})
+	ours := signedRequest(t, 5252, []string{"p", "theirpubkey"}, []string{"p", "ourpubkey"})
+	for _, request := range []*nostr.Event{open, other, ours} {
+		provider.handleRequest("wss://relay.example.com", request)
+	}
+
+	if queue.Pending(open.ID) || queue.Pending(other.ID) || !queue.Pending(ours.ID) {
+		t.Error("mentions_only provider took the wrong requests")
+	}
+}
+
+func TestProviderRejectsForgedRequests(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(ResponseWriter, *nostr.Event) {}})
+	queue := NewQueue(registry, 0, 10, "")
+	queue.SetProvider("", &fakeOutbox{})
+	provider := NewProvider(registry, queue, nil, "", false)
+	request := signedRequest(t, 5252)
+
+	// A copy with altered content keeps the genuine ID and signature
+	tampered := *request
+	tampered.Content = "something else"
+	forged := signedRequest(t, 5252)
+	forged.Sig = request.Sig
+	for _, event := range []*nostr.Event{&tampered, forged} {
+		provider.handleRequest("wss://evil.example.com", event)
+		if queue.Pending(event.ID) || provider.seen.Contains(event.ID) {
+			t.Fatal("request with an invalid signature was taken")
+		}
+	}
+
+	// The genuine request is still taken afterwards
+	provider.handleRequest("wss://relay.example.com", request)
+	if !queue.Pending(request.ID) {
+		t.Error("genuine request was not taken")
+	}
+}
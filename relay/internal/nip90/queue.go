@@ -0,0 +1,341 @@
+package nip90
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/lru"
+	"github.com/openagentsinc/v3/relay/internal/nip40"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+var ErrQueueClosed = errors.New("job queue is closed")
+
+// ErrDuplicateJob is returned when a job for the request is already pending
+// or has a recent result.
+var ErrDuplicateJob = errors.New("job for this request already exists")
+
+// resultCacheSize bounds the recent job results kept in memory for
+// resubmitted requests; older ones are looked up in the store.
+const resultCacheSize = 1000
+
+// Queue runs job requests on a fixed pool of workers so the websocket reader
+// is never blocked by a slow service, and so in-flight jobs can be drained
+// on shutdown. Every change to a pending job is written to a journal, which
+// lets the relay resume jobs interrupted by a crash or restart.
+type Queue struct {
+	registry *Registry
+	jobs     chan *Job
+	pending  map[*Job]struct{}
+	journal  *journal
+	closed   bool
+	// abandoned stops workers from starting queued jobs once the shutdown
+	// deadline has passed; those jobs are persisted instead.
+	abandoned bool
+	// ctx is passed to running jobs and cancelled along with abandoned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// secretKey signs job output; outbox publishes it to the relays a
+	// request names. Both are optional.
+	secretKey string
+	outbox    Outbox
+	// results maps request IDs to the result of their job.
+	results *lru.Cache
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// Outbox publishes events to other relays.
+type Outbox interface {
+	Publish(event *nostr.Event, relays []string)
+}
+
+func NewQueue(registry *Registry, workers, size int, path string) *Queue {
+	q := &Queue{
+		registry: registry,
+		jobs:     make(chan *Job, size),
+		pending:  make(map[*Job]struct{}),
+		journal:  openJournal(path),
+		results:  lru.New(resultCacheSize),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// SetProvider makes jobs sign their output with secretKey and publish it
+// through outbox to the relays named in the request. Call it before the
+// first job is queued.
+func (q *Queue) SetProvider(secretKey string, outbox Outbox) {
+	q.secretKey = secretKey
+	q.outbox = outbox
+}
+
+func (q *Queue) Enqueue(conn ResponseWriter, request *nostr.Event) error {
+	return q.enqueue(&Job{Request: request, Status: JobQueued, conn: conn})
+}
+
+// EnqueueFrom queues a request taken from the upstream relay at source. Its
+// output is published back to that relay through the outbox.
+func (q *Queue) EnqueueFrom(source string, request *nostr.Event) error {
+	if q.outbox == nil {
+		return errors.New("no outbox to publish upstream job output")
+	}
+	conn := &upstreamWriter{url: source, outbox: q.outbox}
+	return q.enqueue(&Job{Request: request, Status: JobQueued, Source: source, conn: conn})
+}
+
+// Resume queues a job loaded from the journal. Its output goes to conn, or
+// back upstream for jobs taken from another relay. Processing feedback is
+// sent so the customer knows the job is continuing, and the saved context
+// is kept so the handler can pick up where it stopped.
+func (q *Queue) Resume(conn ResponseWriter, job *Job) error {
+	if job.Source != "" && q.outbox != nil {
+		conn = &upstreamWriter{url: job.Source, outbox: q.outbox}
+	}
+	resumed := &Job{Request: job.Request, Status: JobQueued, Context: job.Context, Source: job.Source, conn: conn, queue: q}
+	resumed.log = loggerFor(conn).With("job_id", job.Request.ID, "kind", job.Request.Kind)
+	SendJobFeedback(resumed, job.Request, "processing", "Resumed after relay restart")
+	return q.enqueue(resumed)
+}
+
+// Load returns the jobs the journal kept from the last run, without those
+// whose request has expired. Call it before the first job is queued, and
+// pass the jobs to Resume.
+func (q *Queue) Load() ([]*Job, error) {
+	return q.journal.load()
+}
+
+func (q *Queue) enqueue(job *Job) error {
+	job.queue = q
+	job.log = loggerFor(job.conn).With("job_id", job.Request.ID, "kind", job.Request.Kind)
+
+	// Claim the request before anything else, so that of two connections
+	// submitting it at once only one gets to run it
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if q.pendingJob(job.Request.ID) || q.results.Contains(job.Request.ID) {
+		q.mu.Unlock()
+		return ErrDuplicateJob
+	}
+	q.pending[job] = struct{}{}
+	q.mu.Unlock()
+
+	// Journal the job before a worker can pick it up and change its status
+	q.journal.add(job)
+
+	q.mu.Lock()
+	err := ErrQueueClosed
+	if !q.closed {
+		select {
+		case q.jobs <- job:
+			err = nil
+		default:
+			err = errors.New("job queue is full")
+		}
+	}
+	if err != nil {
+		delete(q.pending, job)
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		q.journal.remove(job.Request.ID)
+		return err
+	}
+	kind := strconv.Itoa(job.Request.Kind)
+	jobsTotal.Inc(kind, "queued")
+	jobsPending.Inc(kind)
+	return nil
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for job := range q.jobs {
+		kind := strconv.Itoa(job.Request.Kind)
+		q.mu.Lock()
+		if q.abandoned {
+			q.mu.Unlock()
+			continue
+		}
+		if job.dropped || nip40.IsExpired(job.Request, time.Now()) {
+			delete(q.pending, job)
+			q.mu.Unlock()
+			q.journal.remove(job.Request.ID)
+			job.log.Info("Dropped job for a deleted or expired request")
+			jobsTotal.Inc(kind, "dropped")
+			jobsPending.Dec(kind)
+			continue
+		}
+		job.Status = JobProcessing
+		q.mu.Unlock()
+		q.journal.setStatus(job.Request.ID, JobProcessing)
+
+		jobsTotal.Inc(kind, "started")
+		start := time.Now()
+		job.log.Info("Job started")
+		q.run(job)
+
+		q.mu.Lock()
+		if q.abandoned && !q.results.Contains(job.Request.ID) {
+			// Cancelled at the shutdown deadline before sending a result:
+			// keep it pending so it is persisted and resumed. It is
+			// counted as finished once it really is, after the restart.
+			q.mu.Unlock()
+			job.log.Info("Job abandoned at shutdown", "duration", time.Since(start).String())
+			jobsTotal.Inc(kind, "abandoned")
+			continue
+		}
+		job.Status = JobFinished
+		delete(q.pending, job)
+		q.mu.Unlock()
+		q.journal.remove(job.Request.ID)
+
+		job.log.Info("Job finished", "duration", time.Since(start).String())
+		jobDuration.ObserveSince(start, kind)
+		jobsTotal.Inc(kind, "finished")
+		jobsPending.Dec(kind)
+	}
+}
+
+func (q *Queue) run(job *Job) {
+	service, ok := q.registry.Lookup(job.Request.Kind)
+	if !ok {
+		job.log.Warn("Unhandled NIP-90 event kind", "kind", job.Request.Kind)
+		return
+	}
+	service.Handle(job, job.Request)
+}
+
+func (q *Queue) signOutput(event *nostr.Event) error {
+	if q.secretKey == "" {
+		event.ID = event.ComputeID()
+		return nil
+	}
+	return event.Sign(q.secretKey)
+}
+
+func (q *Queue) publishOutput(event *nostr.Event, relays []string) {
+	if q.outbox != nil {
+		q.outbox.Publish(event, relays)
+	}
+}
+
+func (q *Queue) saveProgress(job *Job, context string) {
+	q.mu.Lock()
+	job.Context = context
+	q.mu.Unlock()
+
+	q.journal.saveContext(job.Request.ID, context)
+}
+
+func (q *Queue) savedProgress(job *Job) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return job.Context
+}
+
+// Forget drops the job for a request its author has deleted. A queued job is
+// skipped when its turn comes; a running one is left to finish but is no
+// longer journaled, so it is not resumed after a restart.
+func (q *Queue) Forget(requestID, pubKey string) {
+	found := false
+	q.mu.Lock()
+	for job := range q.pending {
+		if job.Request.ID == requestID && job.Request.PubKey == pubKey {
+			job.dropped = true
+			found = true
+		}
+	}
+	q.mu.Unlock()
+
+	if found {
+		q.journal.remove(requestID)
+	}
+}
+
+// Close stops accepting jobs. Jobs already queued keep running.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+}
+
+// Wait blocks until every queued job has finished or ctx is done. When ctx
+// ends first, jobs that have not started yet are left queued and running
+// ones are cancelled; both stay in the journal to be resumed.
+func (q *Queue) Wait(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		q.abandoned = true
+		q.mu.Unlock()
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+// Result returns the result of a recent job for the request, if any.
+func (q *Queue) Result(requestID string) (*nostr.Event, bool) {
+	result, ok := q.results.Get(requestID)
+	if !ok {
+		return nil, false
+	}
+	return result.(*nostr.Event), true
+}
+
+// Pending reports whether a job for the request is queued or processing.
+func (q *Queue) Pending(requestID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pendingJob(requestID)
+}
+
+func (q *Queue) pendingJob(requestID string) bool {
+	for job := range q.pending {
+		if job.Request.ID == requestID {
+			return true
+		}
+	}
+	return false
+}
+
+// Unfinished returns copies of the jobs that are still queued or processing.
+func (q *Queue) Unfinished() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.unfinished()
+}
+
+func (q *Queue) unfinished() []*Job {
+	jobs := make([]*Job, 0, len(q.pending))
+	for job := range q.pending {
+		jobs = append(jobs, &Job{Request: job.Request, Status: job.Status, Context: job.Context, Source: job.Source})
+	}
+	return jobs
+}
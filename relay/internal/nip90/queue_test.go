@@ -0,0 +1,97 @@
+package nip90
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+func TestWaitCancelsRunningJobs(t *testing.T) {
+	started := make(chan struct{})
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(conn ResponseWriter, event *nostr.Event) {
+		close(started)
+		<-contextFor(conn).Done()
+	}})
+	queue := NewQueue(registry, 1, 1, "")
+	request := signedRequest(t, 5252)
+	finished := jobsTotal.Value("5252", "finished")
+	abandoned := jobsTotal.Value("5252", "abandoned")
+	observed := jobDuration.Count("5252")
+	err := queue.Enqueue(&fakeWriter{}, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	queue.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if queue.Wait(ctx) == nil {
+		t.Fatal("Wait returned before the job finished")
+	}
+
+	// Once cancelled the handler returns without a result, and the job stays
+	// pending so it is persisted for the next start
+	queue.wg.Wait()
+	if !queue.Pending(request.ID) {
+		t.Error("cancelled job was dropped from the journal")
+	}
+	// It finishes after the restart, so only then is it counted as finished
+	if jobsTotal.Value("5252", "finished") != finished || jobDuration.Count("5252") != observed {
+		t.Error("abandoned job was counted as finished")
+	}
+	if jobsTotal.Value("5252", "abandoned") != abandoned+1 {
+		t.Error("abandoned job was not counted")
+	}
+}
+
+func TestEnqueueRefusesDuplicateRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	registry := NewRegistry()
+	registry.Register(&Service{Kind: 5252, ResultKind: 6252, Handle: func(ResponseWriter, *nostr.Event) {}})
+	// No workers, so the job stays pending
+	queue := NewQueue(registry, 0, 10, path)
+	request := signedRequest(t, 5252)
+
+	// Of many connections submitting the same request at once, one wins
+	errs := make(chan error, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- queue.Enqueue(&fakeWriter{}, request)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	queued := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			queued++
+		case ErrDuplicateJob:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if queued != 1 || len(queue.Unfinished()) != 1 {
+		t.Fatalf("queued %d jobs, want 1", queued)
+	}
+	// Refusing a duplicate leaves the queued job journaled
+	if ids := journaled(t, path); len(ids) != 1 || ids[0] != request.ID {
+		t.Errorf("journal lists %v", ids)
+	}
+
+	// A request with a recent result is not run again either
+	done := signedRequest(t, 5252)
+	queue.results.Add(done.ID, &nostr.Event{})
+	if err := queue.Enqueue(&fakeWriter{}, done); err != ErrDuplicateJob {
+		t.Errorf("request with a result: got %v", err)
+	}
+}
@@ -1,23 +1,22 @@
 package nip90
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 	"net/url"
-	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/openagentsinc/v3/relay/internal/github"
-	"github.com/openagentsinc/v3/relay/internal/groq"
-	"github.com/openagentsinc/v3/relay/internal/nostr"
-	"github.com/openagentsinc/v3/relay/internal/common"
+	"github.com/openagentsinc/v3/relay/internal/llm"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
-func GetRepoContext(repo string, conn *websocket.Conn, prompt string) string {
-	log.Printf("GetRepoContext called for repo: %s", repo)
-	log.Printf("User prompt: %s", prompt)
+// GetRepoContext answers prompt about repo for the job request. onDelta, if
+// set, receives the answer as it is generated.
+func (h *Handlers) GetRepoContext(ctx context.Context, repo string, conn ResponseWriter, request *nostr.Event, prompt string, onDelta func(string)) string {
+	log := loggerFor(conn)
+	log.Debug("GetRepoContext called", "repo", repo, "prompt", prompt)
 
 	owner, repoName := parseRepo(repo)
 	if owner == "" || repoName == "" {
@@ -26,19 +25,19 @@ func GetRepoContext(repo string, conn *websocket.Conn, prompt string) string {
 
 	// Check if the prompt is a simple structural question
 	if isSimpleStructuralQuestion(prompt) {
-		return handleSimpleStructuralQuestion(owner, repoName, prompt, conn)
+		return h.handleSimpleStructuralQuestion(owner, repoName, prompt, conn)
 	}
 
-	context, err := analyzeRepository(owner, repoName, conn, prompt)
+	repoContext, err := h.analyzeRepository(ctx, owner, repoName, conn, request, prompt)
 	if err != nil {
 		if err == github.ErrGitHubTokenNotSet {
 			return fmt.Sprintf("Error: %v", err)
 		}
-		log.Printf("Error analyzing repository: %v", err)
+		log.Error("Error analyzing repository", "repo", repo, "error", err)
 		return fmt.Sprintf("Error analyzing repository: %v", err)
 	}
 
-	return summarizeContext(context, prompt)
+	return h.summarizeContext(ctx, conn, repoContext, prompt, onDelta)
 }
 
 func isSimpleStructuralQuestion(prompt string) bool {
@@ -51,8 +50,8 @@ func isSimpleStructuralQuestion(prompt string) bool {
 		strings.Contains(lowercasePrompt, "show directories")
 }
 
-func handleSimpleStructuralQuestion(owner, repo, prompt string, conn *websocket.Conn) string {
-	rootContent, err := github.ViewFolder(owner, repo, "", "")
+func (h *Handlers) handleSimpleStructuralQuestion(owner, repo, prompt string, conn ResponseWriter) string {
+	rootContent, err := h.GitHub.ViewFolder(owner, repo, "", "")
 	if err != nil {
 		return fmt.Sprintf("Error viewing root folder: %v", err)
 	}
@@ -94,24 +93,30 @@ func parseRepo(repo string) (string, string) {
 	return parts[0], parts[1]
 }
 
-func analyzeRepository(owner, repo string, conn *websocket.Conn, prompt string) (string, error) {
-	var context strings.Builder
-	context.WriteString(fmt.Sprintf("Repository: https://github.com/%s/%s\n\n", owner, repo))
+func (h *Handlers) analyzeRepository(ctx context.Context, owner, repo string, conn ResponseWriter, request *nostr.Event, prompt string) (string, error) {
+	var repoContext strings.Builder
+	// A job resumed after a restart picks up the context it had gathered
+	saved := savedProgress(conn)
+	if saved != "" {
+		repoContext.WriteString(saved)
+	} else {
+		repoContext.WriteString(fmt.Sprintf("Repository: https://github.com/%s/%s\n\n", owner, repo))
+	}
 
-	rootContent, err := github.ViewFolder(owner, repo, "", "")
+	rootContent, err := h.GitHub.ViewFolder(owner, repo, "", "")
 	if err != nil {
 		return "", fmt.Errorf("error viewing root folder: %v", err)
 	}
 
-	tools := []groq.Tool{
+	tools := []llm.Tool{
 		{
 			Type: "function",
-			Function: groq.ToolFunction{
+			Function: llm.ToolFunction{
 				Name:        "view_file",
 				Description: "View the contents of a file in the repository",
-				Parameters: groq.Parameters{
+				Parameters: llm.Parameters{
 					Type: "object",
-					Properties: map[string]groq.Property{
+					Properties: map[string]llm.Property{
 						"path": {Type: "string", Description: "The path of the file to view"},
 					},
 					Required: []string{"path"},
@@ -120,12 +125,12 @@ func analyzeRepository(owner, repo string, conn *websocket.Conn, prompt string)
 		},
 		{
 			Type: "function",
-			Function: groq.ToolFunction{
+			Function: llm.ToolFunction{
 				Name:        "view_folder",
 				Description: "View the contents of a folder in the repository",
-				Parameters: groq.Parameters{
+				Parameters: llm.Parameters{
 					Type: "object",
-					Properties: map[string]groq.Property{
+					Properties: map[string]llm.Property{
 						"path": {Type: "string", Description: "The path of the folder to view"},
 					},
 					Required: []string{"path"},
@@ -134,12 +139,12 @@ func analyzeRepository(owner, repo string, conn *websocket.Conn, prompt string)
 		},
 		{
 			Type: "function",
-			Function: groq.ToolFunction{
+			Function: llm.ToolFunction{
 				Name:        "generate_summary",
 				Description: "Generate a summary of the given content",
-				Parameters: groq.Parameters{
+				Parameters: llm.Parameters{
 					Type: "object",
-					Properties: map[string]groq.Property{
+					Properties: map[string]llm.Property{
 						"content": {Type: "string", Description: "The content to summarize"},
 					},
 					Required: []string{"content"},
@@ -148,44 +153,48 @@ func analyzeRepository(owner, repo string, conn *websocket.Conn, prompt string)
 		},
 	}
 
-	messages := []groq.ChatMessage{
+	messages := []llm.Message{
 		{Role: "system", Content: "You are a repository analyzer. Analyze the repository structure and content using the provided tools. Focus on the user's prompt and find relevant information. Always provide a direct and detailed answer to the user's question."},
 		{Role: "user", Content: fmt.Sprintf("Analyze the following repository structure and provide a detailed summary, focusing on answering the user's prompt: '%s'\n\nRepository structure:\n%s", prompt, rootContent)},
 	}
+	if saved != "" {
+		messages[1].Content += "\n\nContext gathered so far:\n" + saved
+	}
 
-	for i := 0; i < 5; i++ { // Limit to 5 iterations to prevent infinite loops
-		response, err := groq.ChatCompletionWithTools(messages, tools, nil)
+	for i := 0; i < h.MaxIterations; i++ { // Limit iterations to prevent infinite loops
+		response, err := h.LLM.Chat(ctx, messages, tools)
 		if err != nil {
-			return "", fmt.Errorf("error in ChatCompletionWithTools: %v", err)
+			return "", fmt.Errorf("error in chat completion: %v", err)
 		}
 
-		if len(response.Choices) == 0 || len(response.Choices[0].Message.ToolCalls) == 0 {
+		if len(response.ToolCalls) == 0 {
 			break
 		}
 
-		for _, toolCall := range response.Choices[0].Message.ToolCalls {
-			result, err := executeToolCall(owner, repo, toolCall, conn)
+		for _, toolCall := range response.ToolCalls {
+			result, err := h.executeToolCall(ctx, owner, repo, toolCall, conn, request)
 			if err != nil {
-				log.Printf("Error executing tool call: %v", err)
+				loggerFor(conn).Warn("Error executing tool call", "tool", toolCall.Function.Name, "error", err)
 				continue
 			}
-			messages = append(messages, groq.ChatMessage{
+			messages = append(messages, llm.Message{
 				Role:    "function",
 				Content: result,
 			})
-			context.WriteString(fmt.Sprintf("%s:\n%s\n\n", toolCall.Function.Name, result))
+			repoContext.WriteString(fmt.Sprintf("%s:\n%s\n\n", toolCall.Function.Name, result))
+			saveProgress(conn, repoContext.String())
 		}
 
-		messages = append(messages, groq.ChatMessage{
-			Role:    response.Choices[0].Message.Role,
-			Content: response.Choices[0].Message.Content,
+		messages = append(messages, llm.Message{
+			Role:    response.Role,
+			Content: response.Content,
 		})
 	}
 
-	return context.String(), nil
+	return repoContext.String(), nil
 }
 
-func executeToolCall(owner, repo string, toolCall groq.ToolCall, conn *websocket.Conn) (string, error) {
+func (h *Handlers) executeToolCall(ctx context.Context, owner, repo string, toolCall llm.ToolCall, conn ResponseWriter, request *nostr.Event) (string, error) {
 	var args map[string]string
 	err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
 	if err != nil {
@@ -194,82 +203,64 @@ func executeToolCall(owner, repo string, toolCall groq.ToolCall, conn *websocket
 
 	switch toolCall.Function.Name {
 	case "view_file":
-		content, err := github.ViewFile(owner, repo, args["path"], "")
+		content, err := h.GitHub.ViewFile(owner, repo, args["path"], "")
 		if err != nil {
 			return "", err
 		}
-		sendViewedFileEvent(conn, args["path"])
+		// Progress goes out as feedback on the request: a result kind
+		// would end the customer's conversation
+		SendJobFeedback(conn, request, "processing", fmt.Sprintf("Viewed %s", args["path"]))
 		return content, nil
 	case "view_folder":
-		return github.ViewFolder(owner, repo, args["path"], "")
+		return h.GitHub.ViewFolder(owner, repo, args["path"], "")
 	case "generate_summary":
-		return generateSummary(args["content"])
+		return h.generateSummary(ctx, args["content"])
 	default:
 		return "", fmt.Errorf("unknown tool: %s", toolCall.Function.Name)
 	}
 }
 
-func sendViewedFileEvent(conn *websocket.Conn, path string) {
-	if conn == nil {
-		log.Println("WebSocket connection is not set")
-		return
-	}
-
-	viewedEvent := &nostr.Event{
-		Kind:      6838,
-		Content:   fmt.Sprintf("Viewed %s", path),
-		CreatedAt: time.Now(),
-		Tags:      [][]string{},
-	}
-
-	response := common.CreateEventMessage(viewedEvent)
-	err := conn.WriteJSON(response)
-	if err != nil {
-		log.Printf("Error writing viewed file event to WebSocket: %v", err)
-	}
-}
-
-func generateSummary(content string) (string, error) {
-	messages := []groq.ChatMessage{
+func (h *Handlers) generateSummary(ctx context.Context, content string) (string, error) {
+	messages := []llm.Message{
 		{Role: "system", Content: "You are a helpful assistant that summarizes content. Provide concise summaries."},
 		{Role: "user", Content: "Please summarize the following content:\n\n" + content},
 	}
 
-	response, err := groq.ChatCompletionWithTools(messages, nil, nil)
+	response, err := h.LLM.Chat(ctx, messages, nil)
 	if err != nil {
 		return "", err
 	}
 
-	if len(response.Choices) > 0 {
-		return response.Choices[0].Message.Content, nil
+	if response.Content != "" {
+		return response.Content, nil
 	}
 
 	return "", fmt.Errorf("no summary generated")
 }
 
-func summarizeContext(context, prompt string) string {
-	messages := []groq.ChatMessage{
-		{Role: "system", Content: "You are a helpful assistant that analyzes repository contexts. Provide specific and detailed answers focusing on the user's prompt. Always give a direct and comprehensive answer to the user's question, using information from the repository context. Limit your response to approximately 75 words."},
-		{Role: "user", Content: fmt.Sprintf("Based on the following repository context, please provide a detailed and specific answer to the user's prompt in about 75 words: '%s'\n\nRepository context:\n%s", prompt, context)},
+// summarizeContext answers prompt from repoContext. The answer is returned
+// whole, as streamed to onDelta: agent.max_words only guides its length.
+func (h *Handlers) summarizeContext(ctx context.Context, conn ResponseWriter, repoContext, prompt string, onDelta func(string)) string {
+	messages := []llm.Message{
+		{Role: "system", Content: fmt.Sprintf("You are a helpful assistant that analyzes repository contexts. Provide specific and detailed answers focusing on the user's prompt. Always give a direct and comprehensive answer to the user's question, using information from the repository context. Limit your response to approximately %d words.", h.MaxWords)},
+		{Role: "user", Content: fmt.Sprintf("Based on the following repository context, please provide a detailed and specific answer to the user's prompt in about %d words: '%s'\n\nRepository context:\n%s", h.MaxWords, prompt, repoContext)},
 	}
 
-	response, err := groq.ChatCompletionWithTools(messages, nil, nil)
+	var response *llm.Response
+	var err error
+	if streamer, ok := h.LLM.(llm.Streamer); ok && onDelta != nil {
+		response, err = streamer.ChatStream(ctx, messages, nil, onDelta)
+	} else {
+		response, err = h.LLM.Chat(ctx, messages, nil)
+	}
 	if err != nil {
-		log.Printf("Error summarizing context: %v", err)
+		loggerFor(conn).Error("Error summarizing context", "error", err)
 		return "Error occurred while analyzing the repository context"
 	}
 
-	if len(response.Choices) > 0 {
-		return limitWords(response.Choices[0].Message.Content, 75)
+	if response.Content != "" {
+		return response.Content
 	}
 
 	return "No specific information found related to the query"
-}
-
-func limitWords(s string, maxWords int) string {
-	words := strings.Fields(s)
-	if len(words) <= maxWords {
-		return s
-	}
-	return strings.Join(words[:maxWords], " ") + "..."
 }
\ No newline at end of file
@@ -1,26 +1,180 @@
 package nip90
 
 import (
-	"log"
+	"strings"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/openagentsinc/v3/relay/internal/common"
-	"github.com/openagentsinc/v3/relay/internal/nostr"
+	"github.com/openagentsinc/v3/relay/nostr"
 )
 
-func SendAgentCommandResponse(conn *websocket.Conn, context string) {
+func SendAgentCommandResponse(conn ResponseWriter, request *nostr.Event, context string) {
+	sendJobResult(conn, request, 6838, context) // Event kind for agent command response
+}
+
+// partialFeedbackInterval throttles partial feedback while a result is
+// streamed in.
+const partialFeedbackInterval = 500 * time.Millisecond
+
+// SendJobFeedback sends a NIP-90 kind 7000 feedback event about request.
+func SendJobFeedback(conn ResponseWriter, request *nostr.Event, status, info string) {
+	sendFeedback(conn, request, status, info, "")
+}
+
+func sendFeedback(conn ResponseWriter, request *nostr.Event, status, info, content string) {
+	err := deliver(conn, request, newFeedback(request, status, info, content))
+	if err != nil {
+		loggerFor(conn).Warn("Error writing job feedback", "job_id", request.ID, "error", err)
+	}
+}
+
+func newFeedback(request *nostr.Event, status, info, content string) *nostr.Event {
+	feedbackEvent := &nostr.Event{
+		Kind:      7000,
+		Content:   content,
+		CreatedAt: nostr.Now(),
+		Tags:      [][]string{{"status", status, info}},
+	}
+	if request.ID != "" {
+		feedbackEvent.Tags = append(feedbackEvent.Tags, []string{"e", request.ID})
+	}
+	if request.PubKey != "" {
+		feedbackEvent.Tags = append(feedbackEvent.Tags, []string{"p", request.PubKey})
+	}
+	return feedbackEvent
+}
+
+// partialFeedback forwards output that is still being generated to the
+// customer as "partial" feedback. Each event carries the text produced since
+// the previous one; the job result later carries all of it, so partial
+// feedback only goes to the submitting connection and is never stored or
+// published.
+type partialFeedback struct {
+	conn    ResponseWriter
+	request *nostr.Event
+	pending strings.Builder
+	sent    time.Time
+}
+
+func newPartialFeedback(conn ResponseWriter, request *nostr.Event) *partialFeedback {
+	return &partialFeedback{conn: conn, request: request}
+}
+
+// add queues delta and sends the queued text unless feedback went out less
+// than partialFeedbackInterval ago.
+func (p *partialFeedback) add(delta string) {
+	p.pending.WriteString(delta)
+	if time.Since(p.sent) < partialFeedbackInterval {
+		return
+	}
+	p.flush()
+}
+
+// flush sends the queued text, if any. Call it before the result so no
+// partial feedback arrives after it.
+func (p *partialFeedback) flush() {
+	if p.pending.Len() == 0 {
+		return
+	}
+	event := newFeedback(p.request, "partial", "", p.pending.String())
+	p.pending.Reset()
+	p.sent = time.Now()
+
+	err := finalize(p.conn, event)
+	if err == nil {
+		err = writeDirect(p.conn, common.CreateEventMessage(event))
+	}
+	if err != nil {
+		loggerFor(p.conn).Warn("Error writing partial feedback", "job_id", p.request.ID, "error", err)
+	}
+}
+
+// directWriter is implemented by writers that can send a message to the
+// submitting connection alone, without storing or broadcasting it.
+// WriteDirect does nothing when there is no such connection.
+type directWriter interface {
+	WriteDirect(v interface{}) error
+}
+
+func writeDirect(conn ResponseWriter, v interface{}) error {
+	if w, ok := conn.(directWriter); ok {
+		return w.WriteDirect(v)
+	}
+	return conn.WriteJSON(v)
+}
+
+// sendJobResult builds a NIP-90 result referencing the request, remembers it
+// for duplicate submissions and delivers it to the customer.
+func sendJobResult(conn ResponseWriter, request *nostr.Event, kind int, content string) {
 	responseEvent := &nostr.Event{
-		Kind:      6838, // Event kind for agent command response
-		Content:   context,
-		CreatedAt: time.Now(),
+		Kind:      kind,
+		Content:   content,
+		CreatedAt: nostr.Now(),
 		Tags:      [][]string{},
 	}
+	if request.ID != "" {
+		responseEvent.Tags = append(responseEvent.Tags, []string{"e", request.ID})
+	}
+	if request.PubKey != "" {
+		responseEvent.Tags = append(responseEvent.Tags, []string{"p", request.PubKey})
+	}
+
+	err := deliver(conn, request, responseEvent)
+	if recorder, ok := conn.(resultRecorder); ok {
+		recorder.RecordResult(responseEvent)
+	}
+	if err != nil {
+		loggerFor(conn).Warn("Error writing job result", "job_id", request.ID, "kind", kind, "error", err)
+	}
+}
+
+// resultRecorder is implemented by writers that remember job results so a
+// resubmitted request can be answered without running the service again.
+type resultRecorder interface {
+	RecordResult(result *nostr.Event)
+}
+
+// outputPublisher is implemented by writers that sign job output with the
+// provider key and copy it to other relays.
+type outputPublisher interface {
+	SignOutput(event *nostr.Event) error
+	PublishOutput(event *nostr.Event, relays []string)
+}
 
-	// Send the response back to the client
-	response := common.CreateEventMessage(responseEvent)
-	err := conn.WriteJSON(response)
+// deliver finalizes an event produced for request and writes it to conn.
+// For queued jobs the event is also published to the relays the request
+// asked for.
+func deliver(conn ResponseWriter, request, event *nostr.Event) error {
+	err := finalize(conn, event)
 	if err != nil {
-		log.Println("Error writing agent command response to WebSocket:", err)
+		return err
+	}
+
+	err = conn.WriteJSON(common.CreateEventMessage(event))
+	if publisher, ok := conn.(outputPublisher); ok {
+		if relays := requestedRelays(request); len(relays) > 0 {
+			publisher.PublishOutput(event, relays)
+		}
+	}
+	return err
+}
+
+// finalize signs the event with the provider key for queued jobs, and
+// otherwise only sets its ID.
+func finalize(conn ResponseWriter, event *nostr.Event) error {
+	if publisher, ok := conn.(outputPublisher); ok {
+		return publisher.SignOutput(event)
+	}
+	event.ID = event.ComputeID()
+	return nil
+}
+
+// requestedRelays returns the relays listed in the request's relays tag.
+func requestedRelays(request *nostr.Event) []string {
+	for _, tag := range request.Tags {
+		if len(tag) >= 2 && tag[0] == "relays" {
+			return tag[1:]
+		}
 	}
-}
\ No newline at end of file
+	return nil
+}
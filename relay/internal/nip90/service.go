@@ -0,0 +1,89 @@
+package nip90
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// ResponseWriter delivers job results and feedback to the customer.
+type ResponseWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+type HandlerFunc func(conn ResponseWriter, event *nostr.Event)
+
+// Service describes a NIP-90 job kind this relay can perform.
+type Service struct {
+	Kind        int
+	ResultKind  int
+	Name        string
+	Description string
+	// MinDifficulty is the NIP-13 proof of work a job request must carry
+	// before it is accepted. Zero disables the check.
+	MinDifficulty int
+	Handle        HandlerFunc
+}
+
+type Registry struct {
+	services map[int]*Service
+	mu       sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		services: make(map[int]*Service),
+	}
+}
+
+// DefaultRegistry returns a registry with the transcription and agent
+// command services backed by h.
+func DefaultRegistry(h *Handlers) *Registry {
+	registry := NewRegistry()
+	registry.Register(&Service{
+		Kind:        5252,
+		ResultKind:  6252,
+		Name:        "speech-to-text",
+		Description: "Transcribes base64 encoded audio",
+		Handle:      h.HandleAudioMessage,
+	})
+	registry.Register(&Service{
+		Kind:        5838,
+		ResultKind:  6838,
+		Name:        "agent-command",
+		Description: "Answers questions about a GitHub repository",
+		Handle:      h.HandleAgentCommandRequest,
+	})
+	return registry
+}
+
+func (r *Registry) Register(service *Service) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.services[service.Kind] = service
+}
+
+func (r *Registry) Lookup(kind int) (*Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	service, ok := r.services[kind]
+	return service, ok
+}
+
+// Services returns the registered services ordered by kind.
+func (r *Registry) Services() []*Service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	services := make([]*Service, 0, len(r.services))
+	for _, service := range r.services {
+		services = append(services, service)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Kind < services[j].Kind
+	})
+	return services
+}
@@ -0,0 +1,76 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+)
+
+type chatCompletionRequest struct {
+	Model       string        `json:"model"`
+	Messages    []llm.Message `json:"messages"`
+	Tools       []llm.Tool    `json:"tools,omitempty"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens"`
+	Stream      bool          `json:"stream,omitempty"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message llm.Response `json:"message"`
+	} `json:"choices"`
+}
+
+// Chat sends the conversation to the chat completions endpoint and returns
+// the first choice.
+func (c *Client) Chat(ctx context.Context, messages []llm.Message, tools []llm.Tool) (response *llm.Response, err error) {
+	defer c.observe("chat_completion", time.Now(), &err)
+
+	body, err := c.chatRequestBody(messages, tools, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result chatCompletionResponse
+	err = c.send(ctx, "chat_completion", "/chat/completions", "application/json", body, func(resp *http.Response) error {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+		err = json.Unmarshal(respBody, &result)
+		if err != nil {
+			return fmt.Errorf("failed to parse response: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Choices) == 0 {
+		return nil, fmt.Errorf("response has no choices")
+	}
+
+	return &result.Choices[0].Message, nil
+}
+
+func (c *Client) chatRequestBody(messages []llm.Message, tools []llm.Tool, stream bool) ([]byte, error) {
+	request := chatCompletionRequest{
+		Model:       c.config.ChatModel,
+		Messages:    messages,
+		Tools:       tools,
+		Temperature: c.config.Temperature,
+		MaxTokens:   c.config.MaxTokens,
+		Stream:      stream,
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	return body, nil
+}
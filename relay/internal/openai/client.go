@@ -0,0 +1,138 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+)
+
+const (
+	// defaultTimeout bounds one attempt when Config.Timeout is unset.
+	defaultTimeout = time.Minute
+	// retryDelay is the wait before the first retry; it doubles on every
+	// further one up to maxRetryDelay.
+	retryDelay    = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+type Config struct {
+	// Name identifies the backend in metrics, such as "groq".
+	Name               string
+	APIKey             string
+	BaseURL            string
+	ChatModel          string
+	TranscriptionModel string
+	Temperature        float64
+	MaxTokens          int
+	// Language is the ISO-639-1 language hint sent with transcriptions.
+	// Empty lets the server detect the language.
+	Language string
+	// Timeout bounds each attempt, including reading the response.
+	Timeout time.Duration
+	// MaxRetries is how often a request that was rate limited, hit a server
+	// error or failed on the network is repeated.
+	MaxRetries int
+}
+
+// Client talks to an OpenAI-compatible API, such as Groq, OpenAI, Ollama or
+// a llama.cpp server.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+func NewClient(config Config) *Client {
+	if config.Name == "" {
+		config.Name = "openai"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{},
+	}
+}
+
+// send posts body to path and passes a successful response to read.
+// Unsuccessful statuses become an *APIError. Rate limits, server errors and
+// network failures are retried with jittered exponential backoff, honoring
+// Retry-After; errors returned by read are not retried, and nothing is once
+// ctx is done.
+func (c *Client) send(ctx context.Context, operation, path, contentType string, body []byte, read func(resp *http.Response) error) error {
+	log := logging.Default().With("backend", c.config.Name, "operation", operation)
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, path, contentType, body, read)
+		if err == nil || ctx.Err() != nil || attempt == c.config.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			// Waiting longer than we ever would on our own would stall the job
+			if apiErr.RetryAfter > maxRetryDelay {
+				return err
+			}
+			wait = apiErr.RetryAfter
+		}
+		log.Warn("Model API request failed, retrying", "attempt", attempt+1, "retry_in", wait.String(), "error", err)
+		retriesTotal.Inc(c.config.Name, operation)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, path, contentType string, body []byte, read func(resp *http.Response) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return parseError(resp)
+	}
+	return read(resp)
+}
+
+// retryable reports whether a failed attempt may succeed when repeated.
+func retryable(err error) bool {
+	if errors.Is(err, llm.ErrRateLimited) || errors.Is(err, llm.ErrServer) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+)
+
+// newTestClient serves handler and returns a client for it that retries
+// twice.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(Config{Name: "test", APIKey: "key", BaseURL: server.URL, ChatModel: "model", MaxRetries: 2})
+}
+
+var userMessage = []llm.Message{{Role: "user", Content: "hi"}}
+
+const chatReply = `{"choices":[{"message":{"role":"assistant","content":"hello"}}]}`
+
+func TestChatRetriesRateLimit(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"slow down"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(chatReply))
+	})
+
+	response, err := c.Chat(context.Background(), userMessage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Content != "hello" {
+		t.Errorf("unexpected reply %q", response.Content)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestChatDoesNotRetryUnauthorized(t *testing.T) {
+	var requests int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"Invalid API key","code":"invalid_api_key"}}`))
+	})
+
+	_, err := c.Chat(context.Background(), userMessage, nil)
+	if !errors.Is(err, llm.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+}
+
+func TestChatStopsWaitingWhenContextIsDone(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Chat(ctx, userMessage, nil)
+	if !errors.Is(err, llm.ErrRateLimited) {
+		t.Errorf("expected the rate limit error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("retry wait ignored the context: took %s", elapsed)
+	}
+}
@@ -0,0 +1,122 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+)
+
+// maxErrorBodySize bounds how much of an error response is read.
+const maxErrorBodySize = 64 * 1024
+
+// APIError is an error response from the API. It unwraps to one of the llm
+// errors when the status says what went wrong, so callers can use
+// errors.Is(err, llm.ErrRateLimited) and similar.
+type APIError struct {
+	StatusCode int
+	// Type and Code come from the error body, such as
+	// "invalid_request_error" and "context_length_exceeded".
+	Type    string
+	Code    string
+	Message string
+	// RetryAfter is how long the server asked us to wait, or zero.
+	RetryAfter time.Duration
+	// FailedGeneration is the model output Groq rejected, such as a
+	// malformed tool call.
+	FailedGeneration string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API error (status %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ", " + e.Code
+	}
+	msg += "): " + e.Message
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests:
+		return llm.ErrRateLimited
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return llm.ErrUnauthorized
+	case e.StatusCode >= 500:
+		return llm.ErrServer
+	case e.StatusCode == http.StatusRequestEntityTooLarge || isContextLength(e.Code, e.Message):
+		return llm.ErrContextLength
+	}
+	return nil
+}
+
+func isContextLength(code, message string) bool {
+	if code == "context_length_exceeded" {
+		return true
+	}
+	message = strings.ToLower(message)
+	return strings.Contains(message, "context length") || strings.Contains(message, "context_length")
+}
+
+// errorBody is the error JSON returned by Groq and OpenAI.
+type errorBody struct {
+	Error *struct {
+		Message          string      `json:"message"`
+		Type             string      `json:"type"`
+		Code             interface{} `json:"code"`
+		FailedGeneration string      `json:"failed_generation"`
+	} `json:"error"`
+}
+
+// parseError builds the APIError for a response with an unsuccessful
+// status. Bodies that are not the usual error JSON become the message.
+func parseError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	var body errorBody
+	if json.Unmarshal(data, &body) == nil && body.Error != nil {
+		apiErr.Message = body.Error.Message
+		apiErr.Type = body.Error.Type
+		apiErr.FailedGeneration = body.Error.FailedGeneration
+		// Some servers send the code as a number
+		if body.Error.Code != nil {
+			apiErr.Code = fmt.Sprint(body.Error.Code)
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds, which may be
+// fractional, or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
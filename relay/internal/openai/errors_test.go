@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+)
+
+func errorResponse(status int, retryAfter, body string) *http.Response {
+	header := make(http.Header)
+	if retryAfter != "" {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       APIError
+		is         error
+	}{
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "2",
+			body:       `{"error":{"message":"Rate limit reached","type":"tokens","code":"rate_limit_exceeded"}}`,
+			want:       APIError{StatusCode: 429, Type: "tokens", Code: "rate_limit_exceeded", Message: "Rate limit reached", RetryAfter: 2 * time.Second},
+			is:         llm.ErrRateLimited,
+		},
+		{
+			name:   "numeric code",
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"Invalid API key","code":401}}`,
+			want:   APIError{StatusCode: 401, Code: "401", Message: "Invalid API key"},
+			is:     llm.ErrUnauthorized,
+		},
+		{
+			name:   "context length",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"message":"too long","type":"invalid_request_error","code":"context_length_exceeded"}}`,
+			want:   APIError{StatusCode: 400, Type: "invalid_request_error", Code: "context_length_exceeded", Message: "too long"},
+			is:     llm.ErrContextLength,
+		},
+		{
+			name:   "failed generation",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"message":"Failed to call a function","code":"tool_use_failed","failed_generation":"<function=view_file>"}}`,
+			want:   APIError{StatusCode: 400, Code: "tool_use_failed", Message: "Failed to call a function", FailedGeneration: "<function=view_file>"},
+		},
+		{
+			name:   "not JSON",
+			status: http.StatusBadGateway,
+			body:   "<html>upstream unavailable</html>\n",
+			want:   APIError{StatusCode: 502, Message: "<html>upstream unavailable</html>"},
+			is:     llm.ErrServer,
+		},
+		{
+			name:   "empty body",
+			status: http.StatusServiceUnavailable,
+			want:   APIError{StatusCode: 503, Message: "Service Unavailable"},
+			is:     llm.ErrServer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseError(errorResponse(tt.status, tt.retryAfter, tt.body))
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+			if tt.is != nil && !errors.Is(got, tt.is) {
+				t.Errorf("%v is not %v", got, tt.is)
+			}
+			if tt.is == nil && got.Unwrap() != nil {
+				t.Errorf("%v unwraps to %v", got, got.Unwrap())
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"0.5":                           500 * time.Millisecond,
+		"0":                             0,
+		"-1":                            0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:59:00 GMT": 0,
+		"soon":                          0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
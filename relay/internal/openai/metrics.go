@@ -0,0 +1,24 @@
+package openai
+
+import (
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+var (
+	requestsTotal   = metrics.NewCounterVec("llm_requests_total", "Model API calls, by backend and operation.", "backend", "operation")
+	requestErrors   = metrics.NewCounterVec("llm_request_errors_total", "Model API calls that failed, by backend and operation.", "backend", "operation")
+	retriesTotal    = metrics.NewCounterVec("llm_request_retries_total", "Model API calls repeated after a retryable failure, by backend and operation.", "backend", "operation")
+	requestDuration = metrics.NewHistogramVec("llm_request_duration_seconds", "Model API call latency, by backend and operation.", metrics.DefaultBuckets, "backend", "operation")
+)
+
+// observe records a finished API call. Use with a named error result:
+// defer c.observe("operation", time.Now(), &err).
+func (c *Client) observe(operation string, start time.Time, err *error) {
+	requestsTotal.Inc(c.config.Name, operation)
+	requestDuration.ObserveSince(start, c.config.Name, operation)
+	if *err != nil {
+		requestErrors.Inc(c.config.Name, operation)
+	}
+}
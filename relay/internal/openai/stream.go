@@ -0,0 +1,125 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/internal/llm"
+)
+
+// maxEventSize bounds one server-sent event line.
+const maxEventSize = 1 << 20
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// ChatStream requests a streamed completion and calls onDelta with each
+// piece of content as the server sends it. Tool calls are assembled from
+// their fragments and returned with the full content.
+func (c *Client) ChatStream(ctx context.Context, messages []llm.Message, tools []llm.Tool, onDelta func(delta string)) (response *llm.Response, err error) {
+	defer c.observe("chat_stream", time.Now(), &err)
+
+	body, err := c.chatRequestBody(messages, tools, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.send(ctx, "chat_stream", "/chat/completions", "application/json", body, func(resp *http.Response) error {
+		response, err = readStream(resp, onDelta)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// readStream reads server-sent completion chunks until [DONE]. Its errors
+// are never retried, since deltas may already have been delivered.
+func readStream(resp *http.Response, onDelta func(delta string)) (*llm.Response, error) {
+	response := &llm.Response{Role: "assistant"}
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// Blank lines end an event; others are comments or fields we
+			// do not use
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			response.Content = content.String()
+			return response, nil
+		}
+
+		var chunk chatCompletionChunk
+		err := json.Unmarshal([]byte(data), &chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse stream event: %v", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("stream failed (%s): %s", chunk.Error.Type, chunk.Error.Message)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta
+		if delta.Role != "" {
+			response.Role = delta.Role
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onDelta(delta.Content)
+		}
+		for _, fragment := range delta.ToolCalls {
+			// A fragment either continues a known call or starts the next
+			// one; any other index would make us allocate what it says
+			if fragment.Index < 0 || fragment.Index > len(response.ToolCalls) {
+				return nil, fmt.Errorf("stream has tool call index %d after %d calls", fragment.Index, len(response.ToolCalls))
+			}
+			if fragment.Index == len(response.ToolCalls) {
+				response.ToolCalls = append(response.ToolCalls, llm.ToolCall{})
+			}
+			call := &response.ToolCalls[fragment.Index]
+			if fragment.ID != "" {
+				call.ID = fragment.ID
+			}
+			if fragment.Type != "" {
+				call.Type = fragment.Type
+			}
+			call.Function.Name += fragment.Function.Name
+			call.Function.Arguments += fragment.Function.Arguments
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %v", err)
+	}
+	return nil, fmt.Errorf("stream ended before completion")
+}
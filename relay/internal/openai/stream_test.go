@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// sseHandler writes each event as a server-sent event, flushing after every
+// one so the client reads them as separate chunks.
+func sseHandler(events ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprintf(w, "%s\n\n", event)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	c := newTestClient(t, sseHandler(
+		": keep-alive",
+		`data: {"choices":[{"delta":{"role":"assistant","content":""}}]}`,
+		`data: {"choices":[{"delta":{"content":"Hel"}}]}`,
+		`data: {"choices":[]}`,
+		`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+		"data: [DONE]",
+		`data: {"choices":[{"delta":{"content":"ignored"}}]}`,
+	))
+
+	var deltas []string
+	response, err := c.ChatStream(context.Background(), userMessage, nil, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Role != "assistant" || response.Content != "Hello" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	if strings.Join(deltas, "|") != "Hel|lo" {
+		t.Errorf("unexpected deltas %q", deltas)
+	}
+}
+
+func TestChatStreamAssemblesToolCalls(t *testing.T) {
+	c := newTestClient(t, sseHandler(
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"view_","arguments":""}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"name":"file","arguments":"{\"path\":"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"view_folder","arguments":"{}"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"README.md\"}"}}]}}]}`,
+		"data: [DONE]",
+	))
+
+	response, err := c.ChatStream(context.Background(), userMessage, nil, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.ToolCalls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(response.ToolCalls))
+	}
+	first, second := response.ToolCalls[0], response.ToolCalls[1]
+	if first.ID != "call_1" || first.Function.Name != "view_file" || first.Function.Arguments != `{"path":"README.md"}` {
+		t.Errorf("unexpected first call %+v", first)
+	}
+	if second.ID != "call_2" || second.Function.Name != "view_folder" || second.Function.Arguments != "{}" {
+		t.Errorf("unexpected second call %+v", second)
+	}
+}
+
+func TestChatStreamErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   string
+	}{
+		{
+			name:   "error chunk",
+			events: []string{`data: {"choices":[{"delta":{"content":"Hel"}}]}`, `data: {"error":{"message":"model overloaded","type":"server_error"}}`},
+			want:   "stream failed (server_error): model overloaded",
+		},
+		{
+			name:   "tool call index out of range",
+			events: []string{`data: {"choices":[{"delta":{"tool_calls":[{"index":1000000000,"function":{"name":"x"}}]}}]}`},
+			want:   "stream has tool call index 1000000000 after 0 calls",
+		},
+		{
+			name:   "negative tool call index",
+			events: []string{`data: {"choices":[{"delta":{"tool_calls":[{"index":-1,"function":{"name":"x"}}]}}]}`},
+			want:   "stream has tool call index -1 after 0 calls",
+		},
+		{
+			name:   "malformed chunk",
+			events: []string{`data: {"choices":`},
+			want:   "failed to parse stream event",
+		},
+		{
+			name:   "no [DONE]",
+			events: []string{`data: {"choices":[{"delta":{"content":"Hel"}}]}`},
+			want:   "stream ended before completion",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, sseHandler(tt.events...))
+			_, err := c.ChatStream(context.Background(), userMessage, nil, func(string) {})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+// Transcribe sends audio to the transcriptions endpoint.
+func (c *Client) Transcribe(ctx context.Context, audio []byte, format string) (text string, err error) {
+	defer c.observe("transcribe", time.Now(), &err)
+
+	// Create a buffer to write our multipart form
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	// Add the audio file
+	part, err := writer.CreateFormFile("file", "audio."+format)
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %v", err)
+	}
+	_, err = io.Copy(part, bytes.NewReader(audio))
+	if err != nil {
+		return "", fmt.Errorf("failed to copy audio data: %v", err)
+	}
+
+	// Add other form fields
+	writer.WriteField("model", c.config.TranscriptionModel)
+	writer.WriteField("temperature", "0")
+	writer.WriteField("response_format", "json")
+	if c.config.Language != "" {
+		writer.WriteField("language", c.config.Language)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to close multipart writer: %v", err)
+	}
+
+	var respBody []byte
+	err = c.send(ctx, "transcribe", "/audio/transcriptions", writer.FormDataContentType(), body.Bytes(), func(resp *http.Response) error {
+		respBody, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Parse the JSON response
+	var result struct {
+		Text string `json:"text"`
+	}
+	err = json.Unmarshal(respBody, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return result.Text, nil
+}
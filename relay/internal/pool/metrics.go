@@ -0,0 +1,14 @@
+package pool
+
+import (
+	"github.com/openagentsinc/v3/relay/internal/metrics"
+)
+
+// The relay label is the URL of allowlisted relays and "other" for the rest,
+// since relay URLs come from customers' requests.
+var (
+	publishTotal    = metrics.NewCounterVec("relay_outbound_events_total", "Events published to other relays, by relay and outcome.", "relay", "result")
+	queuedEvents    = metrics.NewGaugeVec("relay_outbound_events_queued", "Events waiting to be published, by relay.", "relay")
+	relaysConnected = metrics.NewGaugeVec("relay_outbound_relays_connected", "Other relays with an open connection, by relay.", "relay")
+	relaysActive    = metrics.NewGaugeVec("relay_outbound_relays_active", "Other relays with a publishing worker.")
+)
@@ -0,0 +1,450 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openagentsinc/v3/relay/client"
+	"github.com/openagentsinc/v3/relay/internal/logging"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+const (
+	// maxRelaysPerEvent bounds how many relays one event is sent to, since
+	// the list comes from a customer's request.
+	maxRelaysPerEvent = 8
+	// queueSize bounds the events waiting for one relay.
+	queueSize = 100
+	// publishTimeout bounds connecting to a relay and waiting for its OK.
+	publishTimeout = 10 * time.Second
+	// otherLabel stands in for relays that are not allowlisted in metrics.
+	otherLabel = "other"
+)
+
+type Options struct {
+	// MaxAttempts is how often an event is sent to a relay before giving up.
+	MaxAttempts int
+	// RetryDelay is the wait after the first failure; it doubles on every
+	// further failure up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Allow lists the relay hosts the pool may publish to. When it is empty
+	// any host is used that resolves to public addresses only; listed hosts
+	// may also resolve to private ones.
+	Allow []string
+	// Deny lists relay hosts that are never published to.
+	Deny []string
+	// MaxRelays bounds how many relays have a worker at once. Events for
+	// further relays are dropped until an idle worker is stopped.
+	MaxRelays int
+	// IdleTimeout is how long a relay's worker and connection are kept
+	// without events to send.
+	IdleTimeout time.Duration
+	Logger      *logging.Logger
+}
+
+// Pool publishes events to other relays. Each relay gets its own connection
+// and queue, so a slow or unreachable relay does not hold up the others.
+type Pool struct {
+	opts   Options
+	relays map[string]*relay
+	closed bool
+	// stop abandons queued events and pending retries once Close gives up
+	// waiting.
+	stop chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+}
+
+// RelayStatus reports how publishing to one relay is going.
+type RelayStatus struct {
+	URL       string
+	Connected bool
+	Queued    int
+	Published uint64
+	// Failed counts failed attempts, including retried ones.
+	Failed      uint64
+	LastError   string
+	LastAttempt time.Time
+}
+
+type relay struct {
+	url string
+	// label is the relay's value for the relay label in metrics.
+	label  string
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	queue  chan *nostr.Event
+	client *client.Client
+	status RelayStatus
+	mu     sync.Mutex
+}
+
+func New(opts Options) *Pool {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	if opts.MaxRetryDelay < opts.RetryDelay {
+		opts.MaxRetryDelay = time.Minute
+	}
+	if opts.MaxRelays <= 0 {
+		opts.MaxRelays = 100
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 5 * time.Minute
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Default()
+	}
+	return &Pool{
+		opts:   opts,
+		relays: make(map[string]*relay),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Publish queues event for each of the relays and returns immediately.
+// Invalid and refused URLs are skipped, and so is a relay whose queue is
+// full or that would exceed MaxRelays.
+func (p *Pool) Publish(event *nostr.Event, urls []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	for i, raw := range urls {
+		if i == maxRelaysPerEvent {
+			p.opts.Logger.Warn("Too many relays for event, ignoring the rest", "event_id", event.ID, "relays", len(urls))
+			break
+		}
+		u, ok := normalizeURL(raw)
+		if !ok {
+			p.opts.Logger.Warn("Ignoring invalid relay URL", "event_id", event.ID, "relay", raw)
+			continue
+		}
+		if !p.permitted(u) {
+			publishTotal.Inc(otherLabel, "refused")
+			p.opts.Logger.Warn("Relay is not allowed, skipping", "event_id", event.ID, "relay", u)
+			continue
+		}
+		r := p.relay(u)
+		if r == nil {
+			publishTotal.Inc(otherLabel, "dropped")
+			p.opts.Logger.Warn("Too many relays, dropping event", "event_id", event.ID, "relay", u)
+			continue
+		}
+		select {
+		case r.queue <- event:
+			publishTotal.Inc(r.label, "queued")
+			queuedEvents.Inc(r.label)
+		default:
+			r.fail("queue is full")
+			publishTotal.Inc(r.label, "dropped")
+			p.opts.Logger.Warn("Outbound queue full, dropping event", "event_id", event.ID, "relay", u)
+		}
+	}
+}
+
+// Status returns the state of every relay the pool has a worker for,
+// sorted by URL. Relays whose worker stopped for being idle are left out.
+func (p *Pool) Status() []RelayStatus {
+	p.mu.Lock()
+	relays := make([]*relay, 0, len(p.relays))
+	for _, r := range p.relays {
+		relays = append(relays, r)
+	}
+	p.mu.Unlock()
+
+	statuses := make([]RelayStatus, 0, len(relays))
+	for _, r := range relays {
+		r.mu.Lock()
+		status := r.status
+		status.Connected = r.client != nil
+		status.Queued = len(r.queue)
+		r.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// Close stops accepting events and waits until the queued ones are sent or
+// ctx is done, then disconnects.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, r := range p.relays {
+			close(r.queue)
+		}
+	}
+	p.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	var err error
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+		close(p.stop)
+	}
+
+	p.mu.Lock()
+	for _, r := range p.relays {
+		r.disconnect()
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// permitted reports whether the allow and deny lists let the pool publish
+// to the relay at url.
+func (p *Pool) permitted(url string) bool {
+	host := hostname(url)
+	if containsHost(p.opts.Deny, host) {
+		return false
+	}
+	return len(p.opts.Allow) == 0 || containsHost(p.opts.Allow, host)
+}
+
+// relay returns the worker for url, starting it if needed, or nil when
+// MaxRelays workers are running. Callers hold p.mu.
+func (p *Pool) relay(url string) *relay {
+	r, ok := p.relays[url]
+	if ok {
+		return r
+	}
+	if len(p.relays) >= p.opts.MaxRelays {
+		return nil
+	}
+
+	r = &relay{
+		url:    url,
+		label:  otherLabel,
+		dial:   dialPublic,
+		queue:  make(chan *nostr.Event, queueSize),
+		status: RelayStatus{URL: url},
+	}
+	// Allowlisted relays were named by the operator, so they get their own
+	// label and may be on a private network
+	if containsHost(p.opts.Allow, hostname(url)) {
+		r.label = url
+		r.dial = nil
+	}
+	p.relays[url] = r
+	relaysActive.Inc()
+	p.wg.Add(1)
+	go p.run(r)
+	return r
+}
+
+func (p *Pool) run(r *relay) {
+	defer p.wg.Done()
+	log := p.opts.Logger.With("relay", r.url)
+
+	for {
+		select {
+		case event, ok := <-r.queue:
+			if !ok {
+				return
+			}
+			queuedEvents.Dec(r.label)
+			p.publish(r, event, log)
+		case <-time.After(p.opts.IdleTimeout):
+			if p.evict(r) {
+				log.Debug("Stopped idle relay worker")
+				return
+			}
+		}
+	}
+}
+
+// publish sends event to the relay, retrying until it is accepted, refused
+// for good or MaxAttempts is reached.
+func (p *Pool) publish(r *relay, event *nostr.Event, log *logging.Logger) {
+	if p.stopped() {
+		publishTotal.Inc(r.label, "failed")
+		return
+	}
+	delay := p.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := p.send(r, event)
+		if err == nil {
+			r.succeed()
+			publishTotal.Inc(r.label, "published")
+			log.Debug("Published event", "event_id", event.ID, "attempt", attempt)
+			return
+		}
+
+		r.fail(err.Error())
+		if errors.Is(err, errForbidden) {
+			publishTotal.Inc(r.label, "refused")
+			log.Warn("Relay address is not public, not publishing", "event_id", event.ID, "error", err)
+			return
+		}
+		if !retryable(err) || attempt == p.opts.MaxAttempts {
+			publishTotal.Inc(r.label, "failed")
+			log.Warn("Giving up publishing event", "event_id", event.ID, "attempts", attempt, "error", err)
+			return
+		}
+		log.Info("Publishing event failed, retrying", "event_id", event.ID, "attempt", attempt, "retry_in", delay.String(), "error", err)
+		publishTotal.Inc(r.label, "retried")
+		select {
+		case <-time.After(delay):
+		case <-p.stop:
+		}
+		if p.stopped() {
+			publishTotal.Inc(r.label, "failed")
+			return
+		}
+		delay *= 2
+		if delay > p.opts.MaxRetryDelay {
+			delay = p.opts.MaxRetryDelay
+		}
+	}
+}
+
+// evict removes an idle relay's worker and disconnects it. It leaves the
+// worker alone if events arrived meanwhile or the pool is closing, since
+// Close then waits for the worker itself.
+func (p *Pool) evict(r *relay) bool {
+	p.mu.Lock()
+	if p.closed || len(r.queue) > 0 {
+		p.mu.Unlock()
+		return false
+	}
+	delete(p.relays, r.url)
+	relaysActive.Dec()
+	p.mu.Unlock()
+
+	r.disconnect()
+	return true
+}
+
+func (p *Pool) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) send(r *relay, event *nostr.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	r.status.LastAttempt = time.Now()
+	c := r.client
+	r.mu.Unlock()
+
+	if c == nil {
+		var err error
+		c, err = client.Dial(ctx, r.url, client.Options{
+			Logger:           p.opts.Logger.With("relay", r.url),
+			DisableReconnect: true,
+			NetDialContext:   r.dial,
+		})
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.client = c
+		r.mu.Unlock()
+		relaysConnected.Inc(r.label)
+	}
+
+	err := c.Publish(ctx, event)
+	if err != nil && !isRejected(err) {
+		// Start over with a fresh connection on the next attempt
+		r.disconnect()
+	}
+	return err
+}
+
+func (r *relay) succeed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Published++
+	r.status.LastError = ""
+}
+
+func (r *relay) fail(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Failed++
+	r.status.LastError = reason
+}
+
+func (r *relay) disconnect() {
+	r.mu.Lock()
+	c := r.client
+	r.client = nil
+	r.mu.Unlock()
+	if c != nil {
+		relaysConnected.Dec(r.label)
+		c.Close()
+	}
+}
+
+func isRejected(err error) bool {
+	_, ok := err.(*client.RejectedError)
+	return ok
+}
+
+// retryable reports whether publishing may succeed on a later attempt. A
+// relay that refused the event is only asked again when it blamed itself
+// or rate limiting.
+func retryable(err error) bool {
+	rejected, ok := err.(*client.RejectedError)
+	if !ok {
+		return true
+	}
+	return strings.HasPrefix(rejected.Message, "rate-limited:") || strings.HasPrefix(rejected.Message, "error:")
+}
+
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(strings.TrimSpace(h), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeURL accepts ws and wss URLs and strips a trailing slash so the
+// same relay is not connected to twice.
+func normalizeURL(raw string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return strings.TrimSuffix(u.String(), "/"), true
+}
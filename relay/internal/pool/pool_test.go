@@ -0,0 +1,261 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// scriptedRelay answers the nth EVENT it receives with replies[n], or with
+// the last reply once the script runs out.
+type scriptedRelay struct {
+	url     string
+	replies []string
+	events  int
+	mu      sync.Mutex
+}
+
+// accept is the scripted reply for an accepted event.
+const accept = ""
+
+func newScriptedRelay(t *testing.T, replies ...string) *scriptedRelay {
+	t.Helper()
+	relay := &scriptedRelay{replies: replies}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			var msg []json.RawMessage
+			if ws.ReadJSON(&msg) != nil {
+				return
+			}
+			var event nostr.Event
+			if len(msg) < 2 || json.Unmarshal(msg[1], &event) != nil {
+				continue
+			}
+			reply := relay.next()
+			_ = ws.WriteJSON([]interface{}{"OK", event.ID, reply == accept, reply})
+		}
+	}))
+	t.Cleanup(server.Close)
+	relay.url = "ws" + strings.TrimPrefix(server.URL, "http")
+	return relay
+}
+
+func (r *scriptedRelay) next() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reply := r.replies[len(r.replies)-1]
+	if r.events < len(r.replies) {
+		reply = r.replies[r.events]
+	}
+	r.events++
+	return reply
+}
+
+func (r *scriptedRelay) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events
+}
+
+func testEvent(t *testing.T) *nostr.Event {
+	t.Helper()
+	key, err := nostr.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &nostr.Event{Kind: 6252, CreatedAt: nostr.Now(), Tags: [][]string{}, Content: "result"}
+	err = event.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// testPool allows the loopback address the test relays listen on.
+func testPool(opts Options) *Pool {
+	opts.Allow = append(opts.Allow, "127.0.0.1")
+	opts.RetryDelay = time.Millisecond
+	return New(opts)
+}
+
+// drain closes the pool, which waits until every queued event is done.
+func drain(t *testing.T, p *Pool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := p.Close(ctx)
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func statusOf(t *testing.T, p *Pool, url string) RelayStatus {
+	t.Helper()
+	for _, status := range p.Status() {
+		if status.URL == url {
+			return status
+		}
+	}
+	t.Fatalf("no status for %s", url)
+	return RelayStatus{}
+}
+
+func TestPublishRetriesUntilAccepted(t *testing.T) {
+	relay := newScriptedRelay(t, "error: database busy", "rate-limited: slow down", accept)
+	p := testPool(Options{MaxAttempts: 5})
+
+	p.Publish(testEvent(t), []string{relay.url})
+	drain(t, p)
+
+	status := statusOf(t, p, relay.url)
+	if status.Published != 1 || status.Failed != 2 || status.LastError != "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if relay.received() != 3 {
+		t.Errorf("relay received %d attempts, want 3", relay.received())
+	}
+}
+
+func TestPublishRefusalIsNotRetried(t *testing.T) {
+	relay := newScriptedRelay(t, "blocked: not on the allowlist")
+	p := testPool(Options{MaxAttempts: 5})
+
+	p.Publish(testEvent(t), []string{relay.url})
+	drain(t, p)
+
+	status := statusOf(t, p, relay.url)
+	if status.Published != 0 || status.Failed != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !strings.Contains(status.LastError, "blocked: not on the allowlist") {
+		t.Errorf("unexpected last error %q", status.LastError)
+	}
+	if relay.received() != 1 {
+		t.Errorf("relay received %d attempts, want 1", relay.received())
+	}
+}
+
+func TestPublishToUnreachableRelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ws://" + listener.Addr().String()
+	listener.Close()
+	p := testPool(Options{MaxAttempts: 3})
+
+	p.Publish(testEvent(t), []string{url})
+	drain(t, p)
+
+	status := statusOf(t, p, url)
+	if status.Failed != 3 || status.Connected {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !strings.Contains(status.LastError, "failed to connect") {
+		t.Errorf("unexpected last error %q", status.LastError)
+	}
+}
+
+func TestPublishRefusesPrivateAddresses(t *testing.T) {
+	relay := newScriptedRelay(t, accept)
+	p := New(Options{MaxAttempts: 5, RetryDelay: time.Millisecond})
+
+	p.Publish(testEvent(t), []string{relay.url, "ws://localhost:1", "ws://[::1]:1"})
+	drain(t, p)
+
+	for _, status := range p.Status() {
+		if status.Failed != 1 || !strings.Contains(status.LastError, errForbidden.Error()) {
+			t.Errorf("unexpected status %+v", status)
+		}
+	}
+	if relay.received() != 0 {
+		t.Errorf("private relay received %d events", relay.received())
+	}
+}
+
+func TestPublishAllowAndDenyLists(t *testing.T) {
+	relay := newScriptedRelay(t, accept)
+	p := testPool(Options{Deny: []string{"relay.example.com"}})
+
+	p.Publish(testEvent(t), []string{relay.url, "wss://relay.example.com", "wss://other.example.com"})
+	drain(t, p)
+
+	statuses := p.Status()
+	if len(statuses) != 1 || statuses[0].URL != relay.url || statuses[0].Published != 1 {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+}
+
+func TestMaxRelays(t *testing.T) {
+	first := newScriptedRelay(t, accept)
+	second := newScriptedRelay(t, accept)
+	p := testPool(Options{MaxRelays: 1})
+
+	p.Publish(testEvent(t), []string{first.url, second.url})
+	drain(t, p)
+
+	if len(p.Status()) != 1 || second.received() != 0 {
+		t.Errorf("published to more than MaxRelays: %+v", p.Status())
+	}
+}
+
+func TestIdleWorkerIsStopped(t *testing.T) {
+	first := newScriptedRelay(t, accept)
+	second := newScriptedRelay(t, accept)
+	p := testPool(Options{MaxRelays: 1, IdleTimeout: 20 * time.Millisecond})
+
+	p.Publish(testEvent(t), []string{first.url})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.Status()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle worker still running: %+v", p.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The freed slot goes to the next relay
+	p.Publish(testEvent(t), []string{second.url})
+	drain(t, p)
+	if first.received() != 1 || second.received() != 1 {
+		t.Errorf("received %d and %d events, want 1 each", first.received(), second.received())
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"1.1.1.1":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.20.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"::":              false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for ip, want := range tests {
+		if got := isPublic(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
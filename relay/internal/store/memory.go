@@ -0,0 +1,135 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+type MemoryStore struct {
+	events map[string]*nostr.Event
+	// index maps each content token to the IDs of events containing it,
+	// backing NIP-50 search filters.
+	index map[string]map[string]struct{}
+	mu    sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events: make(map[string]*nostr.Event),
+		index:  make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *MemoryStore) SaveEvent(event *nostr.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.events[event.ID]; ok {
+		s.unindex(existing)
+	}
+	s.events[event.ID] = event
+	for _, token := range nostr.Tokenize(event.Content) {
+		ids, ok := s.index[token]
+		if !ok {
+			ids = make(map[string]struct{})
+			s.index[token] = ids
+		}
+		ids[event.ID] = struct{}{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) QueryEvents(filter *nostr.Filter) ([]*nostr.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if filter.Search != "" {
+		return s.search(filter), nil
+	}
+
+	results := make([]*nostr.Event, 0)
+	for _, event := range s.events {
+		if filter.Match(event) {
+			results = append(results, event)
+		}
+	}
+
+	// Newest first, as NIP-01 asks for when a limit is applied
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].CreatedAt > results[j].CreatedAt
+	})
+	if filter.Limit > 0 && len(results) > filter.Limit {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) DeleteEvent(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event, ok := s.events[id]; ok {
+		s.unindex(event)
+		delete(s.events, id)
+	}
+	return nil
+}
+
+// search answers a NIP-50 filter from the token index, ordering results by
+// relevance rather than recency.
+func (s *MemoryStore) search(filter *nostr.Filter) []*nostr.Event {
+	// Every term must match, so scanning the rarest term's postings is enough
+	var candidates map[string]struct{}
+	for i, term := range nostr.Tokenize(filter.Search) {
+		ids := s.index[term]
+		if i == 0 || len(ids) < len(candidates) {
+			candidates = ids
+		}
+	}
+
+	type scored struct {
+		event *nostr.Event
+		score int
+	}
+	matches := make([]scored, 0, len(candidates))
+	for id := range candidates {
+		event := s.events[id]
+		if !filter.Match(event) {
+			continue
+		}
+		matches = append(matches, scored{event, nostr.SearchScore(filter.Search, event)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].event.CreatedAt > matches[j].event.CreatedAt
+	})
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+
+	results := make([]*nostr.Event, len(matches))
+	for i, match := range matches {
+		results[i] = match.event
+	}
+	return results
+}
+
+func (s *MemoryStore) unindex(event *nostr.Event) {
+	for _, token := range nostr.Tokenize(event.Content) {
+		if ids, ok := s.index[token]; ok {
+			delete(ids, event.ID)
+			if len(ids) == 0 {
+				delete(s.index, token)
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+func TestSearchOrdersByScoreThenRecency(t *testing.T) {
+	s := NewMemoryStore()
+	events := []*nostr.Event{
+		{ID: "once-old", CreatedAt: 100, Kind: 1, Content: "Nostr relay"},
+		{ID: "once-new", CreatedAt: 200, Kind: 1, Content: "a NOSTR relay"},
+		{ID: "twice", CreatedAt: 50, Kind: 1, Content: "nostr relay, Nostr relay"},
+		{ID: "partial", CreatedAt: 300, Kind: 1, Content: "just a relay"},
+		{ID: "other-kind", CreatedAt: 400, Kind: 7, Content: "nostr relay"},
+	}
+	for _, event := range events {
+		_ = s.SaveEvent(event)
+	}
+
+	tests := []struct {
+		name   string
+		filter nostr.Filter
+		want   []string
+	}{
+		{"single term", nostr.Filter{Search: "nostr", Kinds: []int{1}}, []string{"twice", "once-new", "once-old"}},
+		{"every term must match", nostr.Filter{Search: "relay nostr", Kinds: []int{1}}, []string{"twice", "once-new", "once-old"}},
+		{"case is folded", nostr.Filter{Search: "RELAY", Kinds: []int{1}}, []string{"twice", "partial", "once-new", "once-old"}},
+		{"limit keeps the best", nostr.Filter{Search: "nostr relay", Kinds: []int{1}, Limit: 2}, []string{"twice", "once-new"}},
+		{"other filter fields apply", nostr.Filter{Search: "nostr", Kinds: []int{7}}, []string{"other-kind"}},
+		{"missing term", nostr.Filter{Search: "nostr client"}, []string{}},
+		{"no terms", nostr.Filter{Search: "!!"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.QueryEvents(&tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, event := range results {
+				got = append(got, event.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexFollowsDeletes(t *testing.T) {
+	s := NewMemoryStore()
+	_ = s.SaveEvent(&nostr.Event{ID: "a", CreatedAt: 1, Content: "hello"})
+	_ = s.DeleteEvent("a")
+
+	results, _ := s.QueryEvents(&nostr.Filter{Search: "hello"})
+	if len(results) != 0 || len(s.index) != 0 {
+		t.Errorf("deleted event still searchable: %d results, %d tokens", len(results), len(s.index))
+	}
+}
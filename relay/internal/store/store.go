@@ -0,0 +1,14 @@
+package store
+
+import (
+	"github.com/openagentsinc/v3/relay/nostr"
+)
+
+// Store persists events accepted by the relay so they can be served to
+// later subscriptions.
+type Store interface {
+	SaveEvent(event *nostr.Event) error
+	QueryEvents(filter *nostr.Filter) ([]*nostr.Event, error)
+	DeleteEvent(id string) error
+	Close() error
+}
@@ -0,0 +1,119 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+)
+
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt Timestamp  `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+func (e *Event) Serialize() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// CanonicalSerialize returns the NIP-01 serialization the event ID is the
+// hash of: [0,<pubkey>,<created_at>,<kind>,<tags>,<content>] with no
+// whitespace and only the escapes NIP-01 allows.
+func (e *Event) CanonicalSerialize() []byte {
+	b := make([]byte, 0, 100+len(e.Content)+len(e.PubKey))
+	b = append(b, `[0,`...)
+	b = appendString(b, e.PubKey)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, int64(e.CreatedAt), 10)
+	b = append(b, ',')
+	b = strconv.AppendInt(b, int64(e.Kind), 10)
+	b = append(b, ",["...)
+	for i, tag := range e.Tags {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '[')
+		for j, value := range tag {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			b = appendString(b, value)
+		}
+		b = append(b, ']')
+	}
+	b = append(b, "],"...)
+	b = appendString(b, e.Content)
+	return append(b, ']')
+}
+
+// ComputeID returns the hex sha256 of the canonical serialization.
+func (e *Event) ComputeID() string {
+	sum := sha256.Sum256(e.CanonicalSerialize())
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckID reports whether the event's ID matches its content.
+func (e *Event) CheckID() bool {
+	return e.ID == e.ComputeID()
+}
+
+// appendString writes s as a JSON string, escaping only what NIP-01 lists:
+// quotes, backslashes and control characters. Everything else, including
+// non-ASCII text and HTML characters, is written as raw UTF-8.
+func appendString(b []byte, s string) []byte {
+	const hexDigits = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, `�`...)
+			} else {
+				b = append(b, s[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+		switch c {
+		case '"':
+			b = append(b, `\"`...)
+		case '\\':
+			b = append(b, `\\`...)
+		case '\n':
+			b = append(b, `\n`...)
+		case '\r':
+			b = append(b, `\r`...)
+		case '\t':
+			b = append(b, `\t`...)
+		case '\b':
+			b = append(b, `\b`...)
+		case '\f':
+			b = append(b, `\f`...)
+		default:
+			if c < 0x20 {
+				b = append(b, `\u00`...)
+				b = append(b, hexDigits[c>>4], hexDigits[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+		i++
+	}
+	return append(b, '"')
+}
+
+func DeserializeEvent(data []byte) (*Event, error) {
+	var e Event
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
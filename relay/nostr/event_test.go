@@ -0,0 +1,120 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// publishedEvents are real events from public relays. Their IDs and
+// signatures were computed by other implementations.
+var publishedEvents = []string{
+	`{"id":"dc90c95f09947507c1044e8f48bcf6350aa6bff1507dd4acfc755b9239b5c962","pubkey":"3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d","created_at":1644271588,"kind":1,"tags":[],"content":"now that https://blueskyweb.org/blog/2-7-2022-overview was announced we can stop working on nostr?","sig":"230e9d8f0ddaf7eb70b5f7741ccfa37e87a455c9a469282e3464e2052d3192cd63a167e196e381ef9d7e69e9ea43af2443b839974dc85d8aaab9efe1d9296524"}`,
+	`{"id":"4376c65d2f232afbe9b882a35baa4f6fe8667c4e684749af565f981833ed6a65","pubkey":"6e468422dfb74a5738702a8823b9b28168abab8655faacb6853cd0ee15deee93","created_at":1673347337,"kind":1,"tags":[["e","3da979448d9ba263864c4d6f14984c423a3838364ec255f03c7904b1ae77f206"],["p","bf2376e17ba4ec269d10fcc996a4746b451152be9031fa48e74553dde5526bce"]],"content":"Walled gardens became prisons, and nostr is the first step towards tearing down the prison walls.","sig":"908a15e46fb4d8675bab026fc230a0e3542bfade63da02d542fb78b2a8513fcd0092619a2c8c1221e581946e0191f2af505dfdf8657a414dbca329186f009262"}`,
+}
+
+func TestPublishedEvents(t *testing.T) {
+	for _, raw := range publishedEvents {
+		event, err := DeserializeEvent([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := event.ComputeID(); id != event.ID {
+			t.Errorf("ComputeID = %s, want %s", id, event.ID)
+		}
+		if !event.CheckID() {
+			t.Errorf("%s: CheckID failed", event.ID)
+		}
+		if !event.CheckSignature() {
+			t.Errorf("%s: CheckSignature failed", event.ID)
+		}
+
+		// Any change to a signed field invalidates the ID
+		event.Content += "."
+		if event.CheckID() || event.CheckSignature() {
+			t.Errorf("%s: modified event still verifies", event.ID)
+		}
+	}
+}
+
+func TestCanonicalSerialize(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name: "published",
+			event: Event{
+				PubKey:    "6e468422dfb74a5738702a8823b9b28168abab8655faacb6853cd0ee15deee93",
+				CreatedAt: 1673347337,
+				Kind:      1,
+				Tags: [][]string{
+					{"e", "3da979448d9ba263864c4d6f14984c423a3838364ec255f03c7904b1ae77f206"},
+					{"p", "bf2376e17ba4ec269d10fcc996a4746b451152be9031fa48e74553dde5526bce"},
+				},
+				Content: "Walled gardens became prisons, and nostr is the first step towards tearing down the prison walls.",
+			},
+			want: `[0,"6e468422dfb74a5738702a8823b9b28168abab8655faacb6853cd0ee15deee93",1673347337,1,[["e","3da979448d9ba263864c4d6f14984c423a3838364ec255f03c7904b1ae77f206"],["p","bf2376e17ba4ec269d10fcc996a4746b451152be9031fa48e74553dde5526bce"]],"Walled gardens became prisons, and nostr is the first step towards tearing down the prison walls."]`,
+		},
+		{
+			name:  "no tags",
+			event: Event{PubKey: "ab", CreatedAt: 0, Kind: 0, Tags: [][]string{}, Content: ""},
+			want:  `[0,"ab",0,0,[],""]`,
+		},
+		{
+			name:  "nil tags",
+			event: Event{PubKey: "ab", CreatedAt: 1, Kind: 7},
+			want:  `[0,"ab",1,7,[],""]`,
+		},
+		{
+			// NIP-01 escapes only these; JSON encoders that also escape
+			// HTML characters or non-ASCII text produce a different ID
+			name:  "escapes",
+			event: Event{PubKey: "ab", CreatedAt: 1, Kind: 1, Tags: [][]string{{"t", "a\"b"}}, Content: "\"\\\n\r\t\b\f\x01 <>& é 🤙"},
+			want:  "[0,\"ab\",1,1,[[\"t\",\"a\\\"b\"]],\"\\\"\\\\\\n\\r\\t\\b\\f\\u0001 <>& é 🤙\"]",
+		},
+	}
+	for _, test := range tests {
+		got := string(test.event.CanonicalSerialize())
+		if got != test.want {
+			t.Errorf("%s:\n got %s\nwant %s", test.name, got, test.want)
+			continue
+		}
+		sum := sha256.Sum256([]byte(test.want))
+		if id := test.event.ComputeID(); id != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: ComputeID = %s, want the hash of the serialization", test.name, id)
+		}
+	}
+}
+
+func TestTimestampUnmarshal(t *testing.T) {
+	var event Event
+	err := json.Unmarshal([]byte(`{"created_at":1673347337}`), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.CreatedAt != 1673347337 {
+		t.Errorf("created_at = %d", event.CreatedAt)
+	}
+
+	for _, invalid := range []string{`1673347337.5`, `1.6e9`, `"1673347337"`, `-1`, `null`, `true`, `99999999999999999999`} {
+		err := json.Unmarshal([]byte(`{"created_at":`+invalid+`}`), &event)
+		if err == nil {
+			t.Errorf("created_at %s accepted", invalid)
+		}
+	}
+}
+
+func TestTimestampMarshal(t *testing.T) {
+	data, err := json.Marshal(Event{CreatedAt: 1673347337, Tags: [][]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(data, &fields)
+	if string(fields["created_at"]) != "1673347337" {
+		t.Errorf("created_at marshaled as %s", fields["created_at"])
+	}
+}
@@ -1,16 +1,15 @@
 package nostr
 
-import (
-	"time"
-)
-
 type Filter struct {
 	IDs     []string  `json:"ids,omitempty"`
 	Authors []string  `json:"authors,omitempty"`
 	Kinds   []int     `json:"kinds,omitempty"`
-	Since   time.Time `json:"since,omitempty"`
-	Until   time.Time `json:"until,omitempty"`
+	Since   Timestamp `json:"since,omitempty"`
+	Until   Timestamp `json:"until,omitempty"`
 	Limit   int       `json:"limit,omitempty"`
+	Search  string    `json:"search,omitempty"`
+	// Tags holds "#<letter>" conditions keyed by the tag name without "#".
+	Tags map[string][]string `json:"-"`
 }
 
 func (f *Filter) Match(e *Event) bool {
@@ -23,15 +22,32 @@ func (f *Filter) Match(e *Event) bool {
 	if len(f.Kinds) > 0 && !containsInt(f.Kinds, e.Kind) {
 		return false
 	}
-	if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+	if f.Since != 0 && e.CreatedAt < f.Since {
+		return false
+	}
+	if f.Until != 0 && e.CreatedAt > f.Until {
 		return false
 	}
-	if !f.Until.IsZero() && e.CreatedAt.After(f.Until) {
+	for name, values := range f.Tags {
+		if !hasTagValue(e, name, values) {
+			return false
+		}
+	}
+	if f.Search != "" && SearchScore(f.Search, e) == 0 {
 		return false
 	}
 	return true
 }
 
+func hasTagValue(e *Event, name string, values []string) bool {
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == name && contains(values, tag[1]) {
+			return true
+		}
+	}
+	return false
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
@@ -0,0 +1,17 @@
+package nostr
+
+// IsEphemeralKind reports whether kind falls in the NIP-01 ephemeral range.
+// Relays broadcast these events to live subscribers but never store them.
+func IsEphemeralKind(kind int) bool {
+	return kind >= 20000 && kind < 30000
+}
+
+func (e *Event) IsEphemeral() bool {
+	return IsEphemeralKind(e.Kind)
+}
+
+// IsAddressableKind reports whether kind falls in the NIP-01 addressable
+// range, where events are identified by kind, pubkey and "d" tag.
+func IsAddressableKind(kind int) bool {
+	return kind >= 30000 && kind < 40000
+}
@@ -0,0 +1,66 @@
+package nostr
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// Difficulty returns the number of leading zero bits in a hex event ID, as
+// defined by NIP-13.
+func Difficulty(id string) int {
+	count := 0
+	for _, c := range id {
+		nibble, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			break
+		}
+		if nibble == 0 {
+			count += 4
+			continue
+		}
+		count += bits.LeadingZeros8(uint8(nibble)) - 4
+		break
+	}
+	return count
+}
+
+// CommittedDifficulty returns the target difficulty the author committed to
+// in the third entry of the "nonce" tag.
+func CommittedDifficulty(e *Event) (int, bool) {
+	for _, tag := range e.Tags {
+		if len(tag) >= 3 && tag[0] == "nonce" {
+			target, err := strconv.Atoi(tag[2])
+			if err != nil {
+				return 0, false
+			}
+			return target, true
+		}
+	}
+	return 0, false
+}
+
+// CheckProofOfWork verifies that the event ID carries at least minDifficulty
+// bits of work and that the committed target, when present, is honest and
+// not below the minimum. The ID must be the hash of the event, otherwise
+// anyone could claim work by sending an ID with leading zeros.
+func CheckProofOfWork(e *Event, minDifficulty int) error {
+	if !e.CheckID() {
+		return fmt.Errorf("event id does not match its content")
+	}
+	difficulty := Difficulty(e.ID)
+	target, committed := CommittedDifficulty(e)
+	if committed && difficulty < target {
+		return fmt.Errorf("difficulty %d is less than committed target %d", difficulty, target)
+	}
+	if minDifficulty <= 0 {
+		return nil
+	}
+	if difficulty < minDifficulty {
+		return fmt.Errorf("difficulty %d is less than %d", difficulty, minDifficulty)
+	}
+	if committed && target < minDifficulty {
+		return fmt.Errorf("committed target %d is less than %d", target, minDifficulty)
+	}
+	return nil
+}
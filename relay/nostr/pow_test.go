@@ -0,0 +1,76 @@
+package nostr
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDifficulty(t *testing.T) {
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{"000000000e9d97a1ab09fc381030b346cdd7a142ad57e6df0b46dc9bef6c7e2d", 36},
+		{"6bf5b4f434813c64b523d2b0e6efe18f3bd0cbbd0a5effd8ece9e00fd2531996", 1},
+		{"00003479309ecdb46b1c04ce129d2709378518588bed6776e60474ebde3159ae", 18},
+		{"ffff", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := Difficulty(test.id); got != test.want {
+			t.Errorf("Difficulty(%q) = %d, want %d", test.id, got, test.want)
+		}
+	}
+}
+
+// mine increments the nonce tag until the event's ID has difficulty bits
+// of work.
+func mine(e *Event, difficulty int) {
+	for nonce := 0; ; nonce++ {
+		e.Tags = [][]string{{"nonce", strconv.Itoa(nonce), strconv.Itoa(difficulty)}}
+		e.ID = e.ComputeID()
+		if Difficulty(e.ID) >= difficulty {
+			return
+		}
+	}
+}
+
+func TestCheckProofOfWork(t *testing.T) {
+	event := &Event{
+		PubKey:    "a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0",
+		CreatedAt: 1700000000,
+		Kind:      5838,
+		Content:   "work",
+	}
+	mine(event, 8)
+
+	err := CheckProofOfWork(event, 8)
+	if err != nil {
+		t.Errorf("mined event refused: %v", err)
+	}
+	err = CheckProofOfWork(event, 16)
+	if err == nil {
+		t.Error("event below the minimum accepted")
+	}
+}
+
+func TestCheckProofOfWorkRejectsFakeID(t *testing.T) {
+	event := &Event{
+		PubKey:    "a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0c0d0e0f0a0b0",
+		CreatedAt: 1700000000,
+		Kind:      5838,
+		Tags:      [][]string{{"nonce", "1", "32"}},
+		Content:   "no work",
+	}
+	// Claim an ID with plenty of leading zeros that is not the event's hash
+	event.ID = strings.Repeat("0", 16) + event.ComputeID()[16:]
+
+	err := CheckProofOfWork(event, 16)
+	if err == nil {
+		t.Fatal("fake ID with leading zeros accepted as proof of work")
+	}
+	if !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package nostr
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text into lowercase search terms for NIP-50 matching.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// SearchScore returns how many times the search terms occur in the event's
+// content, or 0 if any term is missing.
+func SearchScore(query string, e *Event) int {
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, token := range Tokenize(e.Content) {
+		counts[token]++
+	}
+
+	score := 0
+	for _, term := range terms {
+		if counts[term] == 0 {
+			return 0
+		}
+		score += counts[term]
+	}
+	return score
+}
@@ -0,0 +1,48 @@
+package nostr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"Hello, World!", []string{"hello", "world"}},
+		{"NIP-50 search", []string{"nip", "50", "search"}},
+		{"  spaced\tout\nlines ", []string{"spaced", "out", "lines"}},
+		{"Ünïcode Straße", []string{"ünïcode", "straße"}},
+		{"#nostr @relay", []string{"nostr", "relay"}},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchScore(t *testing.T) {
+	tests := []struct {
+		query   string
+		content string
+		want    int
+	}{
+		{"relay", "A relay for relays", 1},
+		{"relay", "relay, relay and RELAY", 3},
+		{"RELAY", "a relay", 1},
+		{"nostr relay", "a nostr relay", 2},
+		{"nostr relay", "nostr relay relay", 3},
+		{"nostr relay", "a nostr client", 0},
+		{"", "anything", 0},
+		{"...", "anything", 0},
+	}
+	for _, tt := range tests {
+		event := &Event{Content: tt.content}
+		if got := SearchScore(tt.query, event); got != tt.want {
+			t.Errorf("SearchScore(%q, %q) = %d, want %d", tt.query, tt.content, got, tt.want)
+		}
+	}
+}
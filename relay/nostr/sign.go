@@ -0,0 +1,81 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// GeneratePrivateKey returns a new hex encoded secp256k1 secret key.
+func GeneratePrivateKey() (string, error) {
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %v", err)
+	}
+	return hex.EncodeToString(key.Serialize()), nil
+}
+
+// GetPublicKey returns the x-only public key for a hex secret key, as used
+// in the pubkey field of events.
+func GetPublicKey(secretKey string) (string, error) {
+	key, err := parsePrivateKey(secretKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(schnorr.SerializePubKey(key.PubKey())), nil
+}
+
+// Sign sets the event's pubkey, ID and BIP-340 signature.
+func (e *Event) Sign(secretKey string) error {
+	key, err := parsePrivateKey(secretKey)
+	if err != nil {
+		return err
+	}
+	e.PubKey = hex.EncodeToString(schnorr.SerializePubKey(key.PubKey()))
+	e.ID = e.ComputeID()
+
+	hash, _ := hex.DecodeString(e.ID)
+	sig, err := schnorr.Sign(key, hash)
+	if err != nil {
+		return fmt.Errorf("failed to sign event: %v", err)
+	}
+	e.Sig = hex.EncodeToString(sig.Serialize())
+	return nil
+}
+
+// CheckSignature reports whether the event has a valid ID and a signature
+// by its pubkey over that ID.
+func (e *Event) CheckSignature() bool {
+	if !e.CheckID() {
+		return false
+	}
+	pubKey, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return false
+	}
+	key, err := schnorr.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash, _ := hex.DecodeString(e.ID)
+	return sig.Verify(hash, key)
+}
+
+func parsePrivateKey(secretKey string) (*btcec.PrivateKey, error) {
+	raw, err := hex.DecodeString(secretKey)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("secret key must be 64 hex characters")
+	}
+	key, _ := btcec.PrivKeyFromBytes(raw)
+	return key, nil
+}
@@ -0,0 +1,46 @@
+package nostr
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Timestamp is a NIP-01 timestamp: whole seconds since the Unix epoch,
+// encoded in JSON as a plain integer.
+type Timestamp int64
+
+func Now() Timestamp {
+	return Timestamp(time.Now().Unix())
+}
+
+func FromTime(t time.Time) Timestamp {
+	return Timestamp(t.Unix())
+}
+
+func (t Timestamp) Time() time.Time {
+	return time.Unix(int64(t), 0)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, int64(t), 10), nil
+}
+
+// UnmarshalJSON only accepts a non-negative integer literal. Strings,
+// fractions and exponents are rejected rather than guessed at.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || len(data) > 19 {
+		return fmt.Errorf("invalid timestamp: %s", data)
+	}
+	for _, c := range data {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("invalid timestamp: %s", data)
+		}
+	}
+	v, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %v", err)
+	}
+	*t = Timestamp(v)
+	return nil
+}